@@ -16,17 +16,24 @@ type annotation struct {
 	Predicate       string  `json:"predicate"`
 	RelevanceScore  float64 `json:"relevanceScore,omitempty"`
 	ConfidenceScore float64 `json:"confidenceScore,omitempty"`
+	// OriginalID is the concept ID sent by Next, when it was rewritten to the ID of the canonical concept.
+	OriginalID string `json:"originalId,omitempty"`
+	// Derived marks the author annotations derived from the byline and the creator of the video rather than made by the editors.
+	Derived bool `json:"derived,omitempty"`
 }
 
 type annsContext struct {
 	videoUUID     string
 	transactionID string
+	originalIDs   map[tag]string
 }
 
 func createAnnotations(nextAnns []tag, context annsContext) ConceptAnnotation {
 	var annotations = make([]annotation, 0)
 	for _, nextAnn := range nextAnns {
-		annotations = append(annotations, newAnnotation(nextAnn))
+		ann := newAnnotation(nextAnn)
+		ann.OriginalID = context.originalIDs[nextAnn]
+		annotations = append(annotations, ann)
 	}
 
 	return ConceptAnnotation{UUID: context.videoUUID, Annotations: annotations}
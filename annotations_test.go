@@ -21,8 +21,8 @@ func TestAnnotationsCreation(t *testing.T) {
 			ConceptAnnotation{
 				videoUUID,
 				[]annotation{
-					{"id1", "isClassifiedBy", defaultRelevanceScore, defaultConfidenceScore},
-					{"id2", "about", defaultRelevanceScore, defaultConfidenceScore},
+					{ID: "id1", Predicate: "isClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+					{ID: "id2", Predicate: "about", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
 				},
 			},
 		},
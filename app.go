@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"os/signal"
@@ -8,18 +9,39 @@ import (
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
-	"github.com/Financial-Times/kafka-client-go/v3"
 	"github.com/Financial-Times/service-status-go/httphandlers"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	cli "github.com/jawher/mow.cli"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const serviceDescription = "Gets the Next video content from queue, transforms annotations to an internal representation and puts a new created annotation content to queue."
 
 type serviceConfig struct {
-	serviceName string
-	appPort     string
+	serviceName                  string
+	appName                      string
+	appSystemCode                string
+	panicGuide                   string
+	appPort                      string
+	inputValidation              string
+	envelopeFormat               string
+	missingTIDPolicy             string
+	maxInvalidAnnotationsPercent int
+	emptyAnnotationsPolicy       string
+	normaliseConceptIDs          bool
+	annotationRules              []annotationRule
+	conceptResolver              conceptResolver
+	concordanceResolver          concordanceResolver
+	conceptTypeLookup            conceptTypeLookup
+	predicateTypes               predicateTypeMatrix
+	inferenceRules               []inferenceRule
+	brands                       *brandTable
+	people                       personLookup
+	unknownConceptPolicy         string
+	unpublishedPolicy            string
+	videoFetcher                 videoFetcher
+	poisonMessageThreshold       int
 }
 
 func main() {
@@ -78,6 +100,222 @@ func main() {
 		Desc:   "The topic to write the messages to.",
 		EnvVar: "Q_WRITE_TOPIC",
 	})
+	deadLetterTopic := app.String(cli.StringOpt{
+		Name:   "dead-letter-topic",
+		Value:  "",
+		Desc:   "The topic to write the messages that could not be mapped to. Dead-lettering is disabled when empty.",
+		EnvVar: "Q_DEAD_LETTER_TOPIC",
+	})
+	qualityTopic := app.String(cli.StringOpt{
+		Name:   "quality-topic",
+		Value:  "",
+		Desc:   "The topic to write the annotation quality reports of the mapped videos to. Reports are only logged when empty.",
+		EnvVar: "Q_QUALITY_TOPIC",
+	})
+	relatedTopic := app.String(cli.StringOpt{
+		Name:   "related-content-topic",
+		Value:  "",
+		Desc:   "The topic to write the curated related content of the mapped videos to, from their related items. Related items are not mapped when empty.",
+		EnvVar: "Q_RELATED_CONTENT_TOPIC",
+	})
+	source := app.String(cli.StringOpt{
+		Name:   "source",
+		Value:  kafkaTransport,
+		Desc:   "Where to read the messages from (kafka, ndjson)",
+		EnvVar: "MESSAGE_SOURCE",
+	})
+	sourceFile := app.String(cli.StringOpt{
+		Name:   "source-file",
+		Value:  stdioPath,
+		Desc:   "NDJSON file to read the messages from when the source is ndjson. Use - for stdin.",
+		EnvVar: "SOURCE_FILE",
+	})
+	sink := app.String(cli.StringOpt{
+		Name:   "sink",
+		Value:  kafkaTransport,
+		Desc:   "Where to write the messages to (kafka, ndjson)",
+		EnvVar: "MESSAGE_SINK",
+	})
+	sinkFile := app.String(cli.StringOpt{
+		Name:   "sink-file",
+		Value:  stdioPath,
+		Desc:   "NDJSON file to write the messages to when the sink is ndjson. Use - for stdout.",
+		EnvVar: "SINK_FILE",
+	})
+	envelopeFormat := app.String(cli.StringOpt{
+		Name:   "envelope-format",
+		Value:  autoEnvelope,
+		Desc:   "Envelope of the consumed messages, unless set by their X-Envelope-Format header: detect it, the bare Next video document, or the Next video under a payload key (auto, raw, payload)",
+		EnvVar: "ENVELOPE_FORMAT",
+	})
+	inputValidation := app.String(cli.StringOpt{
+		Name:   "input-validation",
+		Value:  lenientValidation,
+		Desc:   "How incoming Next video JSON is validated against its schema: strict rejects invalid messages, lenient only logs the violations (strict, lenient)",
+		EnvVar: "INPUT_VALIDATION",
+	})
+	missingTIDPolicy := app.String(cli.StringOpt{
+		Name:   "missing-tid-policy",
+		Value:  "",
+		Desc:   "What to do with messages and /map requests without X-Request-Id: reject them, or generate a synthetic transaction ID (reject, generate). When empty, messages are rejected and /map requests get a generated ID.",
+		EnvVar: "MISSING_TID_POLICY",
+	})
+	maxInvalidAnnotationsPercent := app.Int(cli.IntOpt{
+		Name:   "max-invalid-annotations-percent",
+		Value:  0,
+		Desc:   "Reject the videos with more than this percentage of invalid annotations, sending them to the dead-letter queue. 0 disables the threshold.",
+		EnvVar: "MAX_INVALID_ANNOTATIONS_PERCENT",
+	})
+	poisonMessageThreshold := app.Int(cli.IntOpt{
+		Name:   "poison-message-threshold",
+		Value:  0,
+		Desc:   "Quarantine a message to the dead-letter queue after it failed this many times while the write queue was available. Requires a dead-letter queue. 0 disables the quarantine.",
+		EnvVar: "POISON_MESSAGE_THRESHOLD",
+	})
+	maxRedeliveries := app.Int(cli.IntOpt{
+		Name:   "max-redeliveries",
+		Value:  defaultMaxRedeliveries,
+		Desc:   "Give up on a message, committing its offset, after it was delivered again this many times without being handled. Deliveries while the consumption is paused are not counted. 0 means no limit.",
+		EnvVar: "MAX_REDELIVERIES",
+	})
+	emptyAnnotationsPolicy := app.String(cli.StringOpt{
+		Name:   "empty-annotations-policy",
+		Value:  rejectEmptyAnnotations,
+		Desc:   "What to do with videos whose annotations are all invalid: reject them, or publish an empty annotations set (reject, publish)",
+		EnvVar: "EMPTY_ANNOTATIONS_POLICY",
+	})
+	normaliseConceptIDs := app.Bool(cli.BoolOpt{
+		Name:   "normalise-concept-ids",
+		Value:  false,
+		Desc:   "Rewrite the bare and variant concept IDs to the http://api.ft.com/things/{uuid} form and drop the duplicate annotations. They are only reported when false.",
+		EnvVar: "NORMALISE_CONCEPT_IDS",
+	})
+	unpublishedPolicy := app.String(cli.StringOpt{
+		Name:   "unpublished-policy",
+		Value:  publishUnpublished,
+		Desc:   "What to do with the annotations of the videos whose isPublished is false: publish them, ignore them, or hold them back until the video is published (publish, ignore, hold)",
+		EnvVar: "UNPUBLISHED_POLICY",
+	})
+	annotationRulesFile := app.String(cli.StringOpt{
+		Name:   "annotation-rules-file",
+		Value:  "",
+		Desc:   "JSON file with the business rules checked on the annotations of each mapped video. No rules are checked when empty.",
+		EnvVar: "ANNOTATION_RULES_FILE",
+	})
+	inferenceRulesFile := app.String(cli.StringOpt{
+		Name:   "inference-rules-file",
+		Value:  "",
+		Desc:   "JSON file with the rules deriving implicit annotations from the explicit ones, e.g. mentions from about. No annotations are derived when empty.",
+		EnvVar: "INFERENCE_RULES_FILE",
+	})
+	brandsFile := app.String(cli.StringOpt{
+		Name:   "brands-file",
+		Value:  "",
+		Desc:   "JSON file mapping the series and format values of the videos to the UUIDs of their brands, which are annotated automatically. No brand annotations are added when empty.",
+		EnvVar: "BRANDS_FILE",
+	})
+	peopleFile := app.String(cli.StringOpt{
+		Name:   "people-file",
+		Value:  "",
+		Desc:   "JSON file mapping the usernames and byline names of the videos to the UUIDs of their Person concepts, which are annotated as authors. Cannot be used together with --people-api-url.",
+		EnvVar: "PEOPLE_FILE",
+	})
+	peopleAPIURL := app.String(cli.StringOpt{
+		Name:   "people-api-url",
+		Value:  "",
+		Desc:   "URL of the people endpoint used to look up the Person concepts of the usernames and byline names of the videos, e.g. http://people-api:8080/people. No author annotations are added when neither this nor --people-file is set.",
+		EnvVar: "PEOPLE_API_URL",
+	})
+	predicateTypesFile := app.String(cli.StringOpt{
+		Name:   "predicate-types-file",
+		Value:  "",
+		Desc:   "JSON file with the concept types allowed for each predicate. Annotations of concepts of other types are dropped. The concept types are not checked when empty.",
+		EnvVar: "PREDICATE_TYPES_FILE",
+	})
+	conceptsAPIURL := app.String(cli.StringOpt{
+		Name:   "concepts-api-url",
+		Value:  "",
+		Desc:   "URL of the concepts endpoint used to check that the annotated concepts exist and to look up their types, e.g. http://concepts-api:8080/concepts. The concepts are not checked when empty.",
+		EnvVar: "CONCEPTS_API_URL",
+	})
+	concordancesAPIURL := app.String(cli.StringOpt{
+		Name:   "concordances-api-url",
+		Value:  "",
+		Desc:   "URL of the concordances endpoint used to rewrite the annotated concepts to their canonical concepts, e.g. http://public-concordances-api:8080/concordances. The concepts are not rewritten when empty.",
+		EnvVar: "CONCORDANCES_API_URL",
+	})
+	conceptsAPITimeout := app.String(cli.StringOpt{
+		Name:   "concepts-api-timeout",
+		Value:  "2s",
+		Desc:   "Timeout of the requests to the concepts, concordances and people endpoints",
+		EnvVar: "CONCEPTS_API_TIMEOUT",
+	})
+	nextVideoAPIURL := app.String(cli.StringOpt{
+		Name:   "next-video-api-url",
+		Value:  "",
+		Desc:   "URL of the Next video API used to fetch the full document of the events carrying no annotations, e.g. http://next-video-api:8080/video. Such events are mapped as they are when empty.",
+		EnvVar: "NEXT_VIDEO_API_URL",
+	})
+	nextVideoAPITimeout := app.String(cli.StringOpt{
+		Name:   "next-video-api-timeout",
+		Value:  "5s",
+		Desc:   "Timeout of each request to the Next video API",
+		EnvVar: "NEXT_VIDEO_API_TIMEOUT",
+	})
+	nextVideoAPIRetries := app.Int(cli.IntOpt{
+		Name:   "next-video-api-retries",
+		Value:  2,
+		Desc:   "How many times a failed request to the Next video API is retried",
+		EnvVar: "NEXT_VIDEO_API_RETRIES",
+	})
+	conceptsCacheSize := app.Int(cli.IntOpt{
+		Name:   "concepts-cache-size",
+		Value:  10000,
+		Desc:   "Maximum number of concept, concordance and person lookups to cache, each",
+		EnvVar: "CONCEPTS_CACHE_SIZE",
+	})
+	conceptsCacheTTL := app.String(cli.StringOpt{
+		Name:   "concepts-cache-ttl",
+		Value:  "10m",
+		Desc:   "How long the concept, concordance and person lookups are cached for",
+		EnvVar: "CONCEPTS_CACHE_TTL",
+	})
+	unknownConceptPolicy := app.String(cli.StringOpt{
+		Name:   "unknown-concept-policy",
+		Value:  dropUnknownConcepts,
+		Desc:   "What to do with the annotations of concepts unknown to the concepts endpoint: drop the annotation, keep it, or fail the whole video (drop, keep, fail)",
+		EnvVar: "UNKNOWN_CONCEPT_POLICY",
+	})
+	tracingExporter := app.String(cli.StringOpt{
+		Name:   "tracing-exporter",
+		Value:  noExporter,
+		Desc:   "Where to export the OpenTelemetry traces to (otlp, stdout, none). The otlp exporter is configured with the standard OTEL_EXPORTER_OTLP_* variables.",
+		EnvVar: "TRACING_EXPORTER",
+	})
+	deadLetterFile := app.String(cli.StringOpt{
+		Name:   "dead-letter-file",
+		Value:  "",
+		Desc:   "NDJSON file to write the messages that could not be mapped to when the sink is ndjson. Dead-lettering is disabled when empty.",
+		EnvVar: "DEAD_LETTER_FILE",
+	})
+	qualityFile := app.String(cli.StringOpt{
+		Name:   "quality-file",
+		Value:  "",
+		Desc:   "NDJSON file to write the annotation quality reports to when the sink is ndjson. Reports are only logged when empty.",
+		EnvVar: "QUALITY_FILE",
+	})
+	relatedFile := app.String(cli.StringOpt{
+		Name:   "related-content-file",
+		Value:  "",
+		Desc:   "NDJSON file to write the curated related content to when the sink is ndjson. Related items are not mapped when empty.",
+		EnvVar: "RELATED_CONTENT_FILE",
+	})
+	coalescingWindow := app.String(cli.StringOpt{
+		Name:   "coalescing-window",
+		Value:  "0s",
+		Desc:   "Hold the mapped messages of a video for this long, e.g. 5s, sending only the newest one. Deletes are sent straight away. 0s disables coalescing.",
+		EnvVar: "COALESCING_WINDOW",
+	})
 	logLevel := app.String(cli.StringOpt{
 		Name:   "logLevel",
 		Value:  "INFO",
@@ -96,44 +334,202 @@ func main() {
 	log.Infof("[Startup] %s is starting ", *serviceName)
 
 	app.Action = func() {
-		if *kafkaAddress == "" {
+		window, err := time.ParseDuration(*coalescingWindow)
+		if err != nil {
+			log.WithError(err).Error("Invalid coalescing window")
+			cli.Exit(1)
+		}
+		tc := transportConfig{
+			source:               *source,
+			sourceFile:           *sourceFile,
+			sink:                 *sink,
+			sinkFile:             *sinkFile,
+			kafkaAddress:         *kafkaAddress,
+			group:                *group,
+			readTopic:            *readTopic,
+			writeTopic:           *writeTopic,
+			deadLetterTopic:      *deadLetterTopic,
+			deadLetterFile:       *deadLetterFile,
+			qualityTopic:         *qualityTopic,
+			qualityFile:          *qualityFile,
+			relatedTopic:         *relatedTopic,
+			relatedFile:          *relatedFile,
+			consumerLagTolerance: *consumerLagTolerance,
+			maxRedeliveries:      *maxRedeliveries,
+			coalescingWindow:     window,
+		}
+		if !isEnvelopeFormat(*envelopeFormat) {
+			log.Errorf("Unknown envelope format %q. Quitting...", *envelopeFormat)
+			cli.Exit(1)
+		}
+		if !isValidationMode(*inputValidation) {
+			log.Errorf("Unknown input validation mode %q. Quitting...", *inputValidation)
+			cli.Exit(1)
+		}
+		if !isMissingTIDPolicy(*missingTIDPolicy) {
+			log.Errorf("Unknown missing transaction ID policy %q. Quitting...", *missingTIDPolicy)
+			cli.Exit(1)
+		}
+		if *maxInvalidAnnotationsPercent < 0 || *maxInvalidAnnotationsPercent > 100 {
+			log.Errorf("Invalid annotations percentage %d is not between 0 and 100. Quitting...", *maxInvalidAnnotationsPercent)
+			cli.Exit(1)
+		}
+		if *poisonMessageThreshold < 0 {
+			log.Errorf("Poison message threshold %d is negative. Quitting...", *poisonMessageThreshold)
+			cli.Exit(1)
+		}
+		if *poisonMessageThreshold > 0 && !tc.hasSink(tc.deadLetterTopic, tc.deadLetterFile) {
+			log.Error("A poison message threshold requires a dead-letter queue to quarantine the messages to. Quitting...")
+			cli.Exit(1)
+		}
+		if *maxRedeliveries < 0 {
+			log.Errorf("Maximum redeliveries %d is negative. Quitting...", *maxRedeliveries)
+			cli.Exit(1)
+		}
+		if !isEmptyAnnotationsPolicy(*emptyAnnotationsPolicy) {
+			log.Errorf("Unknown empty annotations policy %q. Quitting...", *emptyAnnotationsPolicy)
+			cli.Exit(1)
+		}
+		annotationRules, err := loadAnnotationRules(*annotationRulesFile)
+		if err != nil {
+			log.WithError(err).Error("Could not load the annotation rules")
+			cli.Exit(1)
+		}
+		if !isUnpublishedPolicy(*unpublishedPolicy) {
+			log.Errorf("Unknown unpublished policy %q. Quitting...", *unpublishedPolicy)
+			cli.Exit(1)
+		}
+		if !isUnknownConceptPolicy(*unknownConceptPolicy) {
+			log.Errorf("Unknown unknown concept policy %q. Quitting...", *unknownConceptPolicy)
+			cli.Exit(1)
+		}
+		conceptsTimeout, err := time.ParseDuration(*conceptsAPITimeout)
+		if err != nil {
+			log.WithError(err).Error("Invalid concepts endpoint timeout")
+			cli.Exit(1)
+		}
+		conceptsTTL, err := time.ParseDuration(*conceptsCacheTTL)
+		if err != nil {
+			log.WithError(err).Error("Invalid concepts cache TTL")
+			cli.Exit(1)
+		}
+		inferenceRules, err := loadInferenceRules(*inferenceRulesFile)
+		if err != nil {
+			log.WithError(err).Error("Could not load the inference rules")
+			cli.Exit(1)
+		}
+		brands, err := loadBrandTable(*brandsFile)
+		if err != nil {
+			log.WithError(err).Error("Could not load the brand table")
+			cli.Exit(1)
+		}
+		if *peopleFile != "" && *peopleAPIURL != "" {
+			log.Error("Only one of the people file and the people endpoint can be set. Quitting...")
+			cli.Exit(1)
+		}
+		var people personLookup
+		if *peopleAPIURL != "" {
+			people = newHTTPPeopleResolver(*peopleAPIURL, conceptsTimeout, *conceptsCacheSize, conceptsTTL)
+		}
+		peopleTable, err := loadPeopleTable(*peopleFile)
+		if err != nil {
+			log.WithError(err).Error("Could not load the people table")
+			cli.Exit(1)
+		}
+		if peopleTable != nil {
+			people = peopleTable
+		}
+		predicateTypes, err := loadPredicateTypes(*predicateTypesFile)
+		if err != nil {
+			log.WithError(err).Error("Could not load the predicate types")
+			cli.Exit(1)
+		}
+		var resolver conceptResolver
+		var typeLookup conceptTypeLookup
+		if *conceptsAPIURL != "" {
+			conceptsAPI := newHTTPConceptResolver(*conceptsAPIURL, conceptsTimeout, *conceptsCacheSize, conceptsTTL)
+			resolver, typeLookup = conceptsAPI, conceptsAPI
+		}
+		var fetcher videoFetcher
+		if *nextVideoAPIURL != "" {
+			fetchTimeout, err := time.ParseDuration(*nextVideoAPITimeout)
+			if err != nil {
+				log.WithError(err).Error("Invalid Next video API timeout")
+				cli.Exit(1)
+			}
+			if *nextVideoAPIRetries < 0 {
+				log.Errorf("Next video API retries %d is negative. Quitting...", *nextVideoAPIRetries)
+				cli.Exit(1)
+			}
+			fetcher = newHTTPVideoFetcher(*nextVideoAPIURL, fetchTimeout, *nextVideoAPIRetries)
+		}
+		var concordances concordanceResolver
+		if *concordancesAPIURL != "" {
+			concordances = newHTTPConcordanceResolver(*concordancesAPIURL, conceptsTimeout, *conceptsCacheSize, conceptsTTL)
+		}
+		if tc.usesKafka() && *kafkaAddress == "" {
 			log.Info("No queue kafkaAddress provided. Quitting...")
 			cli.Exit(1)
 		}
 
-		producerConfig := kafka.ProducerConfig{
-			BrokersConnectionString: *kafkaAddress,
-			Topic:                   *writeTopic,
-			ConnectionRetryInterval: time.Minute,
+		shutdownTracing, err := initTracing(*tracingExporter, *serviceName)
+		if err != nil {
+			log.WithError(err).Error("Could not initialise tracing")
+			cli.Exit(1)
 		}
-		producer := kafka.NewProducer(producerConfig, log)
+		defer func() {
+			err := shutdownTracing(context.Background())
+			if err != nil {
+				log.WithError(err).Error("Could not flush traces")
+			}
+		}()
 
-		sc := serviceConfig{
-			serviceName: *serviceName,
-			appPort:     *appPort,
+		out, err := newOutputs(tc, log)
+		if err != nil {
+			log.WithError(err).Error("Could not create message sinks")
+			cli.Exit(1)
 		}
-		annMapper := newQueueHandler(sc, producer, log)
+		defer out.close(log)
 
-		consumerConfig := kafka.ConsumerConfig{
-			BrokersConnectionString: *kafkaAddress,
-			ConsumerGroup:           *group,
-			ConnectionRetryInterval: time.Minute,
-		}
-		topics := []*kafka.Topic{
-			kafka.NewTopic(*readTopic, kafka.WithLagTolerance(int64(*consumerLagTolerance))),
+		consumer, err := newSource(tc, log)
+		if err != nil {
+			log.WithError(err).Error("Could not create message source")
+			cli.Exit(1)
 		}
-		consumer := kafka.NewConsumer(consumerConfig, topics, log)
-		go consumer.Start(annMapper.queueConsume)
-		defer func(consumer *kafka.Consumer) {
+		defer func(consumer Source) {
 			err := consumer.Close()
 			if err != nil {
 				log.WithError(err).Error("Consumer could not stop")
 			}
 		}(consumer)
 
-		sh := newServiceHandler(sc, log)
-		hc := NewHealthCheck(producer, consumer, *appName, *systemCode, *panicGuide)
-		go listen(sh, hc, log)
+		sc := serviceConfig{
+			serviceName:                  *serviceName,
+			appName:                      *appName,
+			appSystemCode:                *systemCode,
+			panicGuide:                   *panicGuide,
+			appPort:                      *appPort,
+			inputValidation:              *inputValidation,
+			envelopeFormat:               *envelopeFormat,
+			missingTIDPolicy:             *missingTIDPolicy,
+			maxInvalidAnnotationsPercent: *maxInvalidAnnotationsPercent,
+			emptyAnnotationsPolicy:       *emptyAnnotationsPolicy,
+			normaliseConceptIDs:          *normaliseConceptIDs,
+			annotationRules:              annotationRules,
+			conceptResolver:              resolver,
+			concordanceResolver:          concordances,
+			conceptTypeLookup:            typeLookup,
+			predicateTypes:               predicateTypes,
+			inferenceRules:               inferenceRules,
+			brands:                       brands,
+			people:                       people,
+			unknownConceptPolicy:         *unknownConceptPolicy,
+			unpublishedPolicy:            *unpublishedPolicy,
+			videoFetcher:                 fetcher,
+			poisonMessageThreshold:       *poisonMessageThreshold,
+		}
+		router := startService(sc, consumer, out, log)
+		go listen(router, sc, log)
 
 		log.Infof("[Shutdown] %s is shutting down", *appName)
 		waitForSignal()
@@ -144,17 +540,49 @@ func main() {
 	}
 }
 
-func listen(sh *serviceHandler, hc *HealthCheck, log *logger.UPPLogger) {
+// startService starts mapping the messages read from source to sink
+// and returns the router serving the HTTP endpoints of the service.
+func startService(sc serviceConfig, source Source, out outputs, log *logger.UPPLogger) http.Handler {
+	annMapper := newQueueHandler(sc, out.annotations, log)
+	if out.deadLetter != nil {
+		annMapper.deadLetterProducer = out.deadLetter
+	}
+	if out.quality != nil {
+		annMapper.qualityProducer = out.quality
+	}
+	if out.related != nil {
+		annMapper.relatedProducer = out.related
+	}
+	handler := annMapper.queueConsume
+	if sc.poisonMessageThreshold > 0 && out.deadLetter != nil {
+		handler = newPoisonMessageGuard(sc.poisonMessageThreshold, out.annotations, annMapper.quarantine, log).guard(handler)
+	}
+	consumption := newConsumptionBreaker(out.annotations, log)
+	go source.Start(consumption.guard(handler))
+
+	sh := newServiceHandler(sc, log)
+	hc := NewHealthCheck(out.annotations, source, sc.appName, sc.appSystemCode, sc.panicGuide)
+	hc.consumption = consumption
+	return newRouter(sh, hc)
+}
+
+func newRouter(sh *serviceHandler, hc *HealthCheck) *mux.Router {
 	r := mux.NewRouter()
 	r.Path("/map").Handler(handlers.MethodHandler{"POST": http.HandlerFunc(sh.mapRequest)})
 	r.Path(httphandlers.BuildInfoPath).HandlerFunc(httphandlers.BuildInfoHandler)
 	r.Path(httphandlers.PingPath).HandlerFunc(httphandlers.PingHandler)
 	r.Path("/__health").Handler(handlers.MethodHandler{"GET": http.HandlerFunc(hc.Health())})
+	r.Path(schemasPath).Handler(handlers.MethodHandler{"GET": http.HandlerFunc(listSchemas)})
+	r.Path(schemasPath + "/{name}").Handler(handlers.MethodHandler{"GET": http.HandlerFunc(getSchema)})
+	r.Path("/metrics").Handler(promhttp.Handler())
 	r.Path(httphandlers.GTGPath).HandlerFunc(httphandlers.NewGoodToGoHandler(hc.GTG))
+	return r
+}
 
-	log.WithFields(sh.sc.asMap()).Info("Service started with configuration")
+func listen(r http.Handler, sc serviceConfig, log *logger.UPPLogger) {
+	log.WithFields(sc.asMap()).Info("Service started with configuration")
 
-	err := http.ListenAndServe(":"+sh.sc.appPort, r)
+	err := http.ListenAndServe(":"+sc.appPort, r)
 	if err != nil {
 		log.WithField("message", err).Info("Closing HTTP server")
 	}
@@ -168,7 +596,24 @@ func waitForSignal() {
 
 func (sc serviceConfig) asMap() map[string]interface{} {
 	return map[string]interface{}{
-		"service-name": sc.serviceName,
-		"service-port": sc.appPort,
+		"service-name":                    sc.serviceName,
+		"service-port":                    sc.appPort,
+		"input-validation":                sc.inputValidation,
+		"envelope-format":                 sc.envelopeFormat,
+		"missing-tid-policy":              sc.missingTIDPolicy,
+		"max-invalid-annotations-percent": sc.maxInvalidAnnotationsPercent,
+		"empty-annotations-policy":        sc.emptyAnnotationsPolicy,
+		"normalise-concept-ids":           sc.normaliseConceptIDs,
+		"annotation-rules":                len(sc.annotationRules),
+		"concepts-checked":                sc.conceptResolver != nil,
+		"concepts-canonicalised":          sc.concordanceResolver != nil,
+		"constrained-predicates":          len(sc.predicateTypes),
+		"inference-rules":                 len(sc.inferenceRules),
+		"brands-mapped":                   sc.brands != nil,
+		"authors-mapped":                  sc.people != nil,
+		"unknown-concept-policy":          sc.unknownConceptPolicy,
+		"unpublished-policy":              sc.unpublishedPolicy,
+		"video-documents-fetched":         sc.videoFetcher != nil,
+		"poison-message-threshold":        sc.poisonMessageThreshold,
 	}
 }
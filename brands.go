@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Fields of the Next video whose values are mapped to brands.
+const (
+	seriesField = "series"
+	formatField = "format"
+)
+
+const (
+	hasBrandPredicate       = "hasBrand"
+	isClassifiedByPredicate = "isClassifiedBy"
+)
+
+// brandTable maps the series and format values of the Next videos to the UUIDs of the brands they belong to,
+// annotating the videos with the brands by its predicates, e.g.
+// {"predicates": ["hasBrand"], "series": {"Market minute": "<uuid>"}, "format": {"Explainer": "<uuid>"}}.
+// The values are matched regardless of case.
+type brandTable struct {
+	Predicates      []string          `json:"predicates,omitempty"`
+	Series          map[string]string `json:"series,omitempty"`
+	Format          map[string]string `json:"format,omitempty"`
+	RelevanceScore  float64           `json:"relevanceScore,omitempty"`
+	ConfidenceScore float64           `json:"confidenceScore,omitempty"`
+}
+
+// loadBrandTable reads the brand table from a JSON file. An empty path means no brand annotations are added.
+func loadBrandTable(path string) (*brandTable, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table brandTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("brand table in %s is not valid JSON: %w", path, err)
+	}
+
+	if len(table.Predicates) == 0 {
+		table.Predicates = []string{isClassifiedByPredicate}
+	}
+	for _, predicate := range table.Predicates {
+		if predicate != hasBrandPredicate && predicate != isClassifiedByPredicate {
+			return nil, fmt.Errorf("brand table in %s uses predicate %q, expected %s or %s", path, predicate, hasBrandPredicate, isClassifiedByPredicate)
+		}
+	}
+	for _, score := range []float64{table.RelevanceScore, table.ConfidenceScore} {
+		if score < 0 || score > 1 {
+			return nil, fmt.Errorf("brand table in %s has score %v, expected between 0 and 1", path, score)
+		}
+	}
+	if table.RelevanceScore == 0 {
+		table.RelevanceScore = defaultDerivedScore
+	}
+	if table.ConfidenceScore == 0 {
+		table.ConfidenceScore = defaultDerivedScore
+	}
+
+	if table.Series, err = normaliseBrands(path, seriesField, table.Series); err != nil {
+		return nil, err
+	}
+	if table.Format, err = normaliseBrands(path, formatField, table.Format); err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+// normaliseBrands checks the brand UUIDs of the values of a field, keying them by their normalised values.
+func normaliseBrands(path, field string, brands map[string]string) (map[string]string, error) {
+	normalised := make(map[string]string, len(brands))
+	for value, brandUUID := range brands {
+		parsed, err := uuid.Parse(brandUUID)
+		if err != nil {
+			return nil, fmt.Errorf("brand table in %s maps %s %q to %q, which is not a UUID", path, field, value, brandUUID)
+		}
+		normalised[normaliseBrandValue(value)] = parsed.String()
+	}
+	return normalised, nil
+}
+
+func normaliseBrandValue(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// brandValues returns the values of a field of the Next video, which holds either a single value or an array of them.
+func brandValues(video map[string]interface{}, field string) []string {
+	switch v := video[field].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// addBrandAnnotations appends the annotations of the brands of the video's series and formats.
+// The annotations of the editors take precedence: no brand annotation is added for a concept already annotated.
+func (vm *videoMapper) addBrandAnnotations(annotations []annotation) []annotation {
+	table := vm.sc.brands
+	if table == nil || vm.isDeleteEvent() {
+		return annotations
+	}
+
+	annotated := make(map[string]bool, len(annotations))
+	for _, ann := range annotations {
+		annotated[ann.ID] = true
+	}
+
+	result := annotations
+	for _, source := range []struct {
+		field  string
+		brands map[string]string
+	}{{seriesField, table.Series}, {formatField, table.Format}} {
+		for _, value := range brandValues(vm.unmarshalled, source.field) {
+			brandUUID, ok := source.brands[normaliseBrandValue(value)]
+			if !ok {
+				continue
+			}
+			brandID := thingsURIPrefix + brandUUID
+			if annotated[brandID] {
+				continue
+			}
+			annotated[brandID] = true
+			for _, predicate := range table.Predicates {
+				brandAnnotations.WithLabelValues(source.field, predicate).Inc()
+				result = append(result, annotation{
+					ID:              brandID,
+					Predicate:       predicate,
+					RelevanceScore:  table.RelevanceScore,
+					ConfidenceScore: table.ConfidenceScore,
+				})
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	marketMinuteBrandID = "http://api.ft.com/things/dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"
+	explainerBrandID    = "http://api.ft.com/things/5c7592a8-1f0c-11e4-b0cb-b2227cce2b54"
+)
+
+func TestLoadBrandTable(t *testing.T) {
+	table, err := loadBrandTable("test-resources/brands.json")
+	require.NoError(t, err)
+	assert.Equal(t, []string{hasBrandPredicate, isClassifiedByPredicate}, table.Predicates)
+	assert.Equal(t, map[string]string{"market minute": "dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54", "explainers": "5c7592a8-1f0c-11e4-b0cb-b2227cce2b54"}, table.Series,
+		"The values should be matched regardless of case and the UUIDs normalised")
+	assert.Equal(t, defaultDerivedScore, table.RelevanceScore)
+
+	table, err = loadBrandTable("")
+	assert.NoError(t, err)
+	assert.Nil(t, table)
+
+	path := filepath.Join(t.TempDir(), "brands.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"series": {"Market Minute": "dbb0bdae-1f0c-11e4-b0cb-b2227cce2b54"}}`), 0644))
+	table, err = loadBrandTable(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{isClassifiedByPredicate}, table.Predicates, "Brands should be annotated with isClassifiedBy by default")
+
+	for _, invalid := range []string{
+		`not json`,
+		`{"predicates": ["about"]}`,
+		`{"series": {"Market Minute": "not-a-uuid"}}`,
+		`{"format": {"Explainer": "not-a-uuid"}}`,
+		`{"relevanceScore": 2}`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := loadBrandTable(path)
+		assert.Error(t, err, "Brand table should be rejected: %s", invalid)
+	}
+}
+
+func TestAddBrandAnnotations(t *testing.T) {
+	table, err := loadBrandTable("test-resources/brands.json")
+	require.NoError(t, err)
+
+	explicit := annotation{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "about", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}
+	tests := []struct {
+		name     string
+		video    string
+		expected []annotation
+	}{
+		{
+			"series brand",
+			`{"series": "market minute"}`,
+			[]annotation{
+				explicit,
+				{ID: marketMinuteBrandID, Predicate: hasBrandPredicate, RelevanceScore: defaultDerivedScore, ConfidenceScore: defaultDerivedScore},
+				{ID: marketMinuteBrandID, Predicate: isClassifiedByPredicate, RelevanceScore: defaultDerivedScore, ConfidenceScore: defaultDerivedScore},
+			},
+		},
+		{
+			"format brands",
+			`{"format": ["Explainer", "Unknown format", 42]}`,
+			[]annotation{
+				explicit,
+				{ID: explainerBrandID, Predicate: hasBrandPredicate, RelevanceScore: defaultDerivedScore, ConfidenceScore: defaultDerivedScore},
+				{ID: explainerBrandID, Predicate: isClassifiedByPredicate, RelevanceScore: defaultDerivedScore, ConfidenceScore: defaultDerivedScore},
+			},
+		},
+		{
+			"same brand from series and format",
+			`{"series": "Explainers", "format": ["Explainer"]}`,
+			[]annotation{
+				explicit,
+				{ID: explainerBrandID, Predicate: hasBrandPredicate, RelevanceScore: defaultDerivedScore, ConfidenceScore: defaultDerivedScore},
+				{ID: explainerBrandID, Predicate: isClassifiedByPredicate, RelevanceScore: defaultDerivedScore, ConfidenceScore: defaultDerivedScore},
+			},
+		},
+		{
+			"explicit annotation takes precedence",
+			`{"format": ["Trump trade"]}`,
+			[]annotation{explicit},
+		},
+		{"no series nor format", `{}`, []annotation{explicit}},
+		{"delete event", `{"deleted": true, "series": "Market Minute"}`, []annotation{explicit}},
+	}
+
+	for _, test := range tests {
+		vm := videoMapper{sc: serviceConfig{brands: table}}
+		require.NoError(t, json.Unmarshal([]byte(test.video), &vm.unmarshalled), test.name)
+		assert.Equal(t, test.expected, vm.addBrandAnnotations([]annotation{explicit}), test.name)
+	}
+
+	vm := videoMapper{unmarshalled: map[string]interface{}{seriesField: "Market Minute"}}
+	assert.Equal(t, []annotation{explicit}, vm.addBrandAnnotations([]annotation{explicit}), "No brands should be added without a brand table")
+}
+
+func TestMapNextVideoAnnotationsAddsBrands(t *testing.T) {
+	table, err := loadBrandTable("test-resources/brands.json")
+	require.NoError(t, err)
+	body := strings.Replace(string(getBytes("next-video-input.json", t)), `"format":[]`, `"format":["Explainer"]`, 1)
+
+	vm := videoMapper{sc: serviceConfig{brands: table}, strContent: body, log: getLogger()}
+	require.NoError(t, vm.unmarshal(context.Background()))
+	content, _, err := vm.mapNextVideoAnnotations(context.Background())
+	require.NoError(t, err, "The brand annotations should be valid output")
+
+	var mapped ConceptAnnotation
+	require.NoError(t, json.Unmarshal(content, &mapped))
+	assert.Contains(t, mapped.Annotations, annotation{ID: explainerBrandID, Predicate: hasBrandPredicate, RelevanceScore: defaultDerivedScore, ConfidenceScore: defaultDerivedScore})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// States of a circuitBreaker.
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+var errBreakerOpen = errors.New("circuit breaker is open")
+
+// circuitBreaker stops calling a failing dependency after a number of consecutive failures.
+// Once open, it lets a single trial call through after the cooldown: the breaker closes again if it succeeds
+// and stays open for another cooldown if it fails. With a maximum cooldown set by withBackoff,
+// the cooldown doubles after each failed trial call, up to that maximum.
+type circuitBreaker struct {
+	failureThreshold int
+	cooldown         time.Duration
+	maxCooldown      time.Duration
+	now              func() time.Time
+
+	mu              sync.Mutex
+	state           string
+	failures        int
+	openedAt        time.Time
+	currentCooldown time.Duration
+}
+
+func newCircuitBreaker(failureThreshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		maxCooldown:      cooldown,
+		now:              time.Now,
+		state:            breakerClosed,
+		currentCooldown:  cooldown,
+	}
+}
+
+// withBackoff makes the cooldown grow exponentially with the failed trial calls, up to maxCooldown.
+func (b *circuitBreaker) withBackoff(maxCooldown time.Duration) *circuitBreaker {
+	b.maxCooldown = maxCooldown
+	return b
+}
+
+// allow tells whether a call may be made, switching an open breaker to half-open once its cooldown is over.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.currentCooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	default:
+		// a trial call is already in progress
+		return false
+	}
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+	b.currentCooldown = b.cooldown
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen {
+		b.currentCooldown *= 2
+		if b.currentCooldown > b.maxCooldown {
+			b.currentCooldown = b.maxCooldown
+		}
+	}
+	if b.state == breakerHalfOpen || b.failures >= b.failureThreshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// trip opens the breaker straight away, regardless of the failure threshold.
+func (b *circuitBreaker) trip() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = b.failureThreshold
+	b.state = breakerOpen
+	b.openedAt = b.now()
+}
+
+func (b *circuitBreaker) currentState() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
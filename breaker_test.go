@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	assert.True(t, b.allow())
+	b.failure()
+	assert.Equal(t, breakerClosed, b.currentState(), "The breaker should stay closed below the failure threshold")
+	b.failure()
+	assert.Equal(t, breakerOpen, b.currentState())
+	assert.False(t, b.allow(), "An open breaker should not allow calls before the cooldown is over")
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(), "A trial call should be allowed after the cooldown")
+	assert.Equal(t, breakerHalfOpen, b.currentState())
+	assert.False(t, b.allow(), "Only a single trial call should be allowed")
+
+	b.failure()
+	assert.Equal(t, breakerOpen, b.currentState(), "A failed trial call should open the breaker again")
+	assert.False(t, b.allow())
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow())
+	b.success()
+	assert.Equal(t, breakerClosed, b.currentState(), "A successful trial call should close the breaker")
+	assert.True(t, b.allow())
+}
+
+func TestCircuitBreakerBackoff(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker(1, time.Second).withBackoff(3 * time.Second)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	now = now.Add(time.Second)
+	assert.True(t, b.allow())
+	b.failure()
+
+	now = now.Add(time.Second)
+	assert.False(t, b.allow(), "The cooldown should double after a failed trial call")
+	now = now.Add(time.Second)
+	assert.True(t, b.allow())
+	b.failure()
+
+	now = now.Add(3 * time.Second)
+	assert.True(t, b.allow(), "The cooldown should not grow beyond its maximum")
+	b.success()
+	b.failure()
+
+	now = now.Add(time.Second)
+	assert.True(t, b.allow(), "A successful call should reset the cooldown")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newLRUCache(2, time.Minute)
+	c.set("a", 1)
+	c.set("b", 2)
+	_, _ = c.get("a")
+	c.set("c", 3)
+
+	_, found := c.get("b")
+	assert.False(t, found, "The least recently used entry should be evicted")
+	value, found := c.get("a")
+	assert.True(t, found)
+	assert.Equal(t, 1, value)
+	value, found = c.get("c")
+	assert.True(t, found)
+	assert.Equal(t, 3, value)
+}
+
+func TestLRUCacheExpiresEntries(t *testing.T) {
+	now := time.Now()
+	c := newLRUCache(2, time.Minute)
+	c.now = func() time.Time { return now }
+	c.set("a", 1)
+
+	now = now.Add(59 * time.Second)
+	_, found := c.get("a")
+	assert.True(t, found)
+
+	now = now.Add(2 * time.Second)
+	_, found = c.get("a")
+	assert.False(t, found, "The entry should have expired")
+}
+
+func TestLRUCacheDisabled(t *testing.T) {
+	c := newLRUCache(0, time.Minute)
+	c.set("a", 1)
+	_, found := c.get("a")
+	assert.False(t, found, "A cache of size 0 should not keep entries")
+}
+
+func TestLRUCacheDelete(t *testing.T) {
+	c := newLRUCache(2, time.Minute)
+	c.set("a", 1)
+	c.delete("a")
+	c.delete("missing")
+
+	_, ok := c.get("a")
+	assert.False(t, ok, "A deleted entry should not be found")
+	c.set("b", 2)
+	c.set("c", 3)
+	_, ok = c.get("b")
+	assert.True(t, ok, "A deleted entry should not take up the size of the cache")
+}
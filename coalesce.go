@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+// coalescingProducer is a messageProducer which can hold the mapped messages of a video for a while,
+// sending only the newest one of those produced in quick succession.
+type coalescingProducer interface {
+	messageProducer
+	// hold keeps the message of the video until its coalescing window is over, replacing any message already held for it.
+	// The returned channel receives the result of sending the message, or nil as soon as a newer message replaces it.
+	hold(videoUUID string, m Message) <-chan error
+	// flush sends the message held for the video straight away, if there is one.
+	flush(videoUUID string) error
+}
+
+type heldMessage struct {
+	message Message
+	timer   *time.Timer
+	sent    chan error
+}
+
+// coalescingSink wraps a Sink, coalescing the messages held for the same video within a window:
+// when the window of a video is over, only the newest of its messages is sent, delivering it again until it is sent.
+// The holder of each message is told once it is sent or replaced. Closing the sink sends the messages still held.
+type coalescingSink struct {
+	Sink
+	window     time.Duration
+	redelivery redelivery
+	log        *logger.UPPLogger
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	// sendMu serialises the sends, so that a flushed message can't overtake a message of the same video being sent
+	sendMu sync.Mutex
+	mu     sync.Mutex
+	held   map[string]*heldMessage
+}
+
+func newCoalescingSink(sink Sink, window time.Duration, maxRedeliveries int, log *logger.UPPLogger) *coalescingSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &coalescingSink{
+		Sink:       sink,
+		window:     window,
+		redelivery: newRedelivery(maxRedeliveries, log),
+		log:        log,
+		ctx:        ctx,
+		cancel:     cancel,
+		held:       make(map[string]*heldMessage),
+	}
+}
+
+func (s *coalescingSink) hold(videoUUID string, m Message) <-chan error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if previous, ok := s.held[videoUUID]; ok {
+		previous.timer.Stop()
+		previous.sent <- nil
+		coalescedMessages.Inc()
+		s.log.WithTransactionID(previous.message.Headers["X-Request-Id"]).
+			WithUUID(videoUUID).
+			Infof("Superseded by the message of transaction %s", m.Headers["X-Request-Id"])
+	} else {
+		heldMessages.Inc()
+	}
+	held := &heldMessage{message: m, sent: make(chan error, 1)}
+	s.keep(videoUUID, held)
+	return held.sent
+}
+
+// keep holds the message until the window of the video is over. It must be called with mu held.
+func (s *coalescingSink) keep(videoUUID string, held *heldMessage) {
+	held.timer = time.AfterFunc(s.window, func() { s.send(videoUUID, held) })
+	s.held[videoUUID] = held
+}
+
+// flush sends the message held for the video once. A message which can't be sent is held again,
+// unless a newer message replaced it in the meantime.
+func (s *coalescingSink) flush(videoUUID string) error {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	held, ok := s.held[videoUUID]
+	if ok {
+		held.timer.Stop()
+		s.release(videoUUID)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	err := s.Sink.SendMessage(held.message)
+	if err == nil {
+		held.sent <- nil
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, replaced := s.held[videoUUID]; replaced {
+		held.sent <- nil
+	} else {
+		heldMessages.Inc()
+		s.keep(videoUUID, held)
+	}
+	return err
+}
+
+// send sends the held message once its window is over, unless it was replaced or flushed in the meantime.
+func (s *coalescingSink) send(videoUUID string, held *heldMessage) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	s.mu.Lock()
+	current := s.held[videoUUID] == held
+	if current {
+		s.release(videoUUID)
+	}
+	s.mu.Unlock()
+
+	if !current {
+		return
+	}
+	err := s.redelivery.deliver(s.ctx, s.Sink.SendMessage, held.message)
+	if err != nil {
+		s.log.WithTransactionID(held.message.Headers["X-Request-Id"]).
+			WithUUID(videoUUID).
+			WithError(err).
+			Error("Error sending the coalesced message")
+	}
+	held.sent <- err
+}
+
+func (s *coalescingSink) release(videoUUID string) {
+	delete(s.held, videoUUID)
+	heldMessages.Dec()
+}
+
+// Close stops the redeliveries and sends the messages still held once, before closing the wrapped Sink.
+func (s *coalescingSink) Close() error {
+	s.cancel()
+	s.sendMu.Lock()
+	s.mu.Lock()
+	held := s.held
+	s.held = make(map[string]*heldMessage)
+	for _, h := range held {
+		h.timer.Stop()
+		heldMessages.Dec()
+	}
+	s.mu.Unlock()
+
+	for videoUUID, h := range held {
+		err := s.Sink.SendMessage(h.message)
+		if err != nil {
+			s.log.WithTransactionID(h.message.Headers["X-Request-Id"]).
+				WithUUID(videoUUID).
+				WithError(err).
+				Error("Error sending the coalesced message on shutdown, its consumed message is left uncommitted")
+		}
+		h.sent <- err
+	}
+	s.sendMu.Unlock()
+	return s.Sink.Close()
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	mu       sync.Mutex
+	messages []Message
+	failing  bool
+	closed   bool
+}
+
+func (s *recordingSink) SendMessage(m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return errors.New("sink is unavailable")
+	}
+	s.messages = append(s.messages, m)
+	return nil
+}
+
+func (s *recordingSink) sent() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *recordingSink) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *recordingSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *recordingSink) ConnectivityCheck() error {
+	return nil
+}
+
+func newTestCoalescingSink(inner Sink, window time.Duration) *coalescingSink {
+	s := newCoalescingSink(inner, window, 0, getLogger())
+	s.redelivery = newTestRedelivery()
+	return s
+}
+
+func TestCoalescingSinkSendsNewestMessage(t *testing.T) {
+	inner := &recordingSink{}
+	s := newTestCoalescingSink(inner, 50*time.Millisecond)
+
+	before := testutil.ToFloat64(coalescedMessages)
+	first := s.hold("video-1", Message{Body: "first"})
+	second := s.hold("video-1", Message{Body: "second"})
+	other := s.hold("video-2", Message{Body: "other"})
+	assert.Empty(t, inner.sent(), "Messages should be held during the window")
+	assert.NoError(t, receive(t, first), "A replaced message should be released straight away")
+	assert.Empty(t, inner.sent())
+
+	assert.NoError(t, receive(t, second))
+	assert.NoError(t, receive(t, other))
+	bodies := []string{inner.sent()[0].Body, inner.sent()[1].Body}
+	assert.ElementsMatch(t, []string{"second", "other"}, bodies, "Only the newest message of each video should be sent")
+	assert.Equal(t, before+1, testutil.ToFloat64(coalescedMessages))
+}
+
+func TestCoalescingSinkFlush(t *testing.T) {
+	inner := &recordingSink{}
+	s := newTestCoalescingSink(inner, time.Minute)
+
+	require.NoError(t, s.flush("video-1"), "Flushing a video without held messages should do nothing")
+	assert.Empty(t, inner.sent())
+
+	sent := s.hold("video-1", Message{Body: "publish"})
+	require.NoError(t, s.flush("video-1"))
+	require.Len(t, inner.sent(), 1)
+	assert.Equal(t, "publish", inner.sent()[0].Body)
+	assert.NoError(t, receive(t, sent), "The holder of a flushed message should be told it was sent")
+
+	require.NoError(t, s.flush("video-1"))
+	assert.Len(t, inner.sent(), 1, "A flushed message should not be sent again")
+}
+
+func TestCoalescingSinkHoldsAgainTheMessagesWhichCouldNotBeFlushed(t *testing.T) {
+	inner := &recordingSink{failing: true}
+	s := newTestCoalescingSink(inner, time.Minute)
+
+	sent := s.hold("video-1", Message{Headers: map[string]string{"X-Request-Id": "tid_publish"}})
+	assert.Error(t, s.flush("video-1"))
+	assert.Equal(t, "tid_publish", s.heldTransactionID("video-1"), "A message which couldn't be flushed should be flushed again with the redelivered delete")
+
+	inner.setFailing(false)
+	require.NoError(t, s.flush("video-1"))
+	assert.NoError(t, receive(t, sent))
+	assert.Len(t, inner.sent(), 1)
+}
+
+func TestCoalescingSinkRedeliversFailedSends(t *testing.T) {
+	inner := &recordingSink{failing: true}
+	s := newTestCoalescingSink(inner, time.Millisecond)
+
+	sent := s.hold("video-1", Message{Body: "publish"})
+	time.Sleep(10 * time.Millisecond)
+	inner.setFailing(false)
+	assert.NoError(t, receive(t, sent), "A message which couldn't be sent should be sent again")
+	assert.Len(t, inner.sent(), 1)
+
+	s.redelivery.maxRedeliveries = 2
+	inner.setFailing(true)
+	assert.ErrorIs(t, receive(t, s.hold("video-1", Message{Body: "publish"})), errRedeliveriesExhausted,
+		"The holder of a message which couldn't be sent should be told once its redeliveries are exhausted")
+}
+
+func TestCoalescingSinkCloseSendsHeldMessages(t *testing.T) {
+	inner := &recordingSink{}
+	s := newTestCoalescingSink(inner, time.Minute)
+
+	sent := s.hold("video-1", Message{Body: "publish"})
+	require.NoError(t, s.Close())
+	require.Len(t, inner.sent(), 1)
+	assert.Equal(t, "publish", inner.sent()[0].Body)
+	assert.NoError(t, receive(t, sent))
+	assert.True(t, inner.closed)
+}
+
+func TestCoalescingSinkDoesNotSendWhileHolding(t *testing.T) {
+	inner := &blockingSink{recordingSink: &recordingSink{}, release: make(chan struct{})}
+	s := newTestCoalescingSink(inner, time.Millisecond)
+
+	first := s.hold("video-1", Message{Body: "first"})
+	assert.Eventually(t, func() bool { return inner.sending() }, time.Second, time.Millisecond)
+
+	held := make(chan struct{})
+	go func() {
+		s.hold("video-2", Message{Body: "other"})
+		close(held)
+	}()
+	select {
+	case <-held:
+	case <-time.After(time.Second):
+		t.Fatal("Holding a message should not wait for a message being sent")
+	}
+	close(inner.release)
+	assert.NoError(t, receive(t, first))
+}
+
+func TestQueueConsumeHandsTheResultOfTheHeldPublishOver(t *testing.T) {
+	inner := &recordingSink{}
+	s := newTestCoalescingSink(inner, time.Minute)
+	h := newQueueHandler(serviceConfig{}, s, getLogger())
+
+	body := string(getBytes("next-video-input.json", t))
+	results := make(map[string]<-chan error)
+	for _, tid := range []string{"tid_save_1", "tid_save_2"} {
+		consumed := Message{Headers: createHeaders(nextVideoOrigin, tid), Body: body}
+		consumed.settle = func(result <-chan error) { results[tid] = result }
+		require.NoError(t, h.queueConsume(consumed), "A held publish should not keep the consumer waiting")
+	}
+	assert.NoError(t, receive(t, results["tid_save_1"]), "A replaced publish should be settled")
+	assert.Empty(t, inner.sent(), "Publishes should be held")
+	select {
+	case <-results["tid_save_2"]:
+		t.Fatal("A held publish should not be settled before it is sent")
+	default:
+	}
+
+	require.NoError(t, h.queueConsume(Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_delete"),
+		Body:    string(getBytes("next-video-delete-input.json", t)),
+	}))
+	assert.NoError(t, receive(t, results["tid_save_2"]))
+	sent := inner.sent()
+	require.Len(t, sent, 2, "A delete should flush the held publish and be sent straight away")
+	assert.Equal(t, "tid_save_2", sent[0].Headers["X-Request-Id"])
+	assert.Equal(t, "tid_delete", sent[1].Headers["X-Request-Id"])
+}
+
+func TestQueueConsumeWaitsForTheHeldPublishWithoutASettlingSource(t *testing.T) {
+	inner := &recordingSink{failing: true}
+	s := newTestCoalescingSink(inner, time.Millisecond)
+	s.redelivery.maxRedeliveries = 1
+	h := newQueueHandler(serviceConfig{}, s, getLogger())
+
+	err := h.queueConsume(Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_save"),
+		Body:    string(getBytes("next-video-input.json", t)),
+	})
+	assert.ErrorIs(t, err, errRedeliveriesExhausted, "A source which can't settle the message later should get the result of the send")
+}
+
+// receive waits for the result of a held message.
+func receive(t *testing.T, sent <-chan error) error {
+	t.Helper()
+	select {
+	case err := <-sent:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("The held message was neither sent nor replaced")
+		return nil
+	}
+}
+
+// heldTransactionID returns the transaction ID of the message held for the video, if any.
+func (s *coalescingSink) heldTransactionID(videoUUID string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if held, ok := s.held[videoUUID]; ok {
+		return held.message.Headers["X-Request-Id"]
+	}
+	return ""
+}
+
+// blockingSink blocks the sending of the messages until release is closed.
+type blockingSink struct {
+	*recordingSink
+	release chan struct{}
+
+	mu       sync.Mutex
+	inFlight bool
+}
+
+func (s *blockingSink) SendMessage(m Message) error {
+	s.mu.Lock()
+	s.inFlight = true
+	s.mu.Unlock()
+	<-s.release
+	return s.recordingSink.SendMessage(m)
+}
+
+func (s *blockingSink) sending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.inFlight
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Policies for the annotations pointing to concepts unknown to UPP.
+const (
+	dropUnknownConcepts = "drop"
+	keepUnknownConcepts = "keep"
+	failUnknownConcepts = "fail"
+)
+
+const (
+	conceptBreakerThreshold = 5
+	conceptBreakerCooldown  = 30 * time.Second
+)
+
+func isUnknownConceptPolicy(policy string) bool {
+	return policy == dropUnknownConcepts || policy == keepUnknownConcepts || policy == failUnknownConcepts
+}
+
+// conceptResolver tells whether a concept is known to UPP.
+type conceptResolver interface {
+	exists(ctx context.Context, conceptUUID string) (bool, error)
+}
+
+// conceptTypeLookup finds the type of a concept, returning an empty type when it is not known.
+type conceptTypeLookup interface {
+	conceptType(ctx context.Context, conceptUUID string) (string, error)
+}
+
+type conceptInfo struct {
+	known       bool
+	conceptType string
+}
+
+// httpConceptResolver checks the concepts against an HTTP concepts endpoint, which responds to GET <url>/<uuid>
+// with 200 and the concept, including its type, for the known concepts and 404 for the unknown ones. Both outcomes are cached.
+type httpConceptResolver struct {
+	url     string
+	lookups *cachedLookup
+}
+
+func newHTTPConceptResolver(url string, timeout time.Duration, cacheSize int, cacheTTL time.Duration) *httpConceptResolver {
+	return &httpConceptResolver{
+		url:     strings.TrimSuffix(url, "/"),
+		lookups: newCachedLookup(timeout, cacheSize, cacheTTL, conceptBreakerThreshold, conceptLookups),
+	}
+}
+
+func (r *httpConceptResolver) exists(ctx context.Context, conceptUUID string) (bool, error) {
+	info, err := r.get(ctx, conceptUUID)
+	return info.known, err
+}
+
+func (r *httpConceptResolver) conceptType(ctx context.Context, conceptUUID string) (string, error) {
+	info, err := r.get(ctx, conceptUUID)
+	return info.conceptType, err
+}
+
+func (r *httpConceptResolver) get(ctx context.Context, conceptUUID string) (conceptInfo, error) {
+	info, err := r.lookups.get(conceptUUID, func() (interface{}, string, error) {
+		info, err := r.lookup(ctx, conceptUUID)
+		return info, knownLookupResult(info.known), err
+	})
+	if err != nil {
+		return conceptInfo{}, err
+	}
+	return info.(conceptInfo), nil
+}
+
+func (r *httpConceptResolver) lookup(ctx context.Context, conceptUUID string) (conceptInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+"/"+conceptUUID, nil)
+	if err != nil {
+		return conceptInfo{}, err
+	}
+	injectHTTPTraceContext(ctx, req.Header)
+
+	resp, err := r.lookups.client.Do(req)
+	if err != nil {
+		return conceptInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return conceptInfo{known: false}, nil
+	default:
+		return conceptInfo{}, fmt.Errorf("concepts endpoint responded with status %d for concept %s", resp.StatusCode, conceptUUID)
+	}
+
+	var concept struct {
+		Type string `json:"type"`
+	}
+	// the type is optional, a concept whose body can't be decoded is still known
+	_ = json.NewDecoder(resp.Body).Decode(&concept)
+	return conceptInfo{known: true, conceptType: concept.Type}, nil
+}
+
+// resolveConcepts checks that the annotated concepts are known to UPP and applies the unknown concept policy.
+// When a concept cannot be checked, because the concepts endpoint is failing, its annotation is kept.
+func (vm *videoMapper) resolveConcepts(ctx context.Context, annotations []tag, videoUUID string) ([]tag, error) {
+	if vm.sc.conceptResolver == nil {
+		return annotations, nil
+	}
+	ctx, span := startSpan(ctx, "resolveConcepts")
+	defer span.End()
+
+	resolved := make([]tag, 0, len(annotations))
+	for _, ann := range annotations {
+		known, err := vm.conceptExists(ctx, ann.thingID)
+		if err != nil {
+			vm.log.WithTransactionID(vm.tid).
+				WithUUID(videoUUID).
+				WithError(err).
+				Warnf("Could not check whether concept %s exists, keeping its annotation", ann.thingID)
+			resolved = append(resolved, ann)
+			continue
+		}
+		if known {
+			resolved = append(resolved, ann)
+			continue
+		}
+
+		me := newMappingError(codeUnknownConcept, fieldPath(annotationsField), "concept %s is not known", ann.thingID)
+		switch vm.sc.unknownConceptPolicy {
+		case failUnknownConcepts:
+			recordSpanError(span, me)
+			return nil, me
+		case keepUnknownConcepts:
+			resolved = append(resolved, ann)
+			me.Severity = severityWarning
+			recordMappingError(me)
+			vm.log.WithTransactionID(vm.tid).
+				WithUUID(videoUUID).
+				WithFields(me.logFields()).
+				Warn("Keeping annotation of unknown concept")
+		default:
+			me.Severity = severityWarning
+			vm.logAnnotationWarning(me, videoUUID, "Dropping annotation of unknown concept")
+		}
+	}
+	return resolved, nil
+}
+
+func (vm *videoMapper) conceptExists(ctx context.Context, thingID string) (bool, error) {
+	matches := conceptIDPattern.FindStringSubmatch(thingID)
+	if matches == nil {
+		// only UUID based concepts can be known to UPP
+		return false, nil
+	}
+	return vm.sc.conceptResolver.exists(ctx, strings.ToLower(matches[1]))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	knownConceptUUID   = "71a5efa5-e6e0-3ce1-9190-a7eac8bef325"
+	unknownConceptUUID = "d969d76e-f8f4-34ae-bc38-95cfd0884740"
+)
+
+// conceptsAPIStub stands in for the concepts endpoint, knowing only knownConceptUUID.
+type conceptsAPIStub struct {
+	mu       sync.Mutex
+	requests int
+	status   int
+	delay    time.Duration
+}
+
+func (s *conceptsAPIStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	status, delay := s.status, s.delay
+	s.mu.Unlock()
+
+	time.Sleep(delay)
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	if strings.TrimPrefix(r.URL.Path, "/concepts/") == knownConceptUUID {
+		_, _ = w.Write([]byte(`{"id":"http://api.ft.com/things/` + knownConceptUUID + `","type":"http://www.ft.com/ontology/person/Person"}`))
+		return
+	}
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (s *conceptsAPIStub) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestHTTPConceptResolver(t *testing.T) {
+	stub := &conceptsAPIStub{}
+	resolver := newHTTPConceptResolver(startStubServer(stub, t)+"/concepts/", 100*time.Millisecond, 10, time.Minute)
+
+	known, err := resolver.exists(context.Background(), knownConceptUUID)
+	assert.NoError(t, err)
+	assert.True(t, known)
+
+	known, err = resolver.exists(context.Background(), unknownConceptUUID)
+	assert.NoError(t, err)
+	assert.False(t, known)
+
+	conceptType, err := resolver.conceptType(context.Background(), knownConceptUUID)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://www.ft.com/ontology/person/Person", conceptType)
+	conceptType, err = resolver.conceptType(context.Background(), unknownConceptUUID)
+	assert.NoError(t, err)
+	assert.Empty(t, conceptType)
+	assert.Equal(t, 2, stub.requestCount(), "Both known and unknown concepts should be cached")
+}
+
+func TestHTTPConceptResolverFailures(t *testing.T) {
+	stub := &conceptsAPIStub{status: http.StatusServiceUnavailable}
+	resolver := newHTTPConceptResolver(startStubServer(stub, t)+"/concepts/", 100*time.Millisecond, 10, time.Minute)
+
+	for i := 0; i < conceptBreakerThreshold; i++ {
+		_, err := resolver.exists(context.Background(), knownConceptUUID)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, conceptBreakerThreshold, stub.requestCount())
+
+	_, err := resolver.exists(context.Background(), knownConceptUUID)
+	assert.ErrorIs(t, err, errBreakerOpen)
+	assert.Equal(t, conceptBreakerThreshold, stub.requestCount(), "No request should be made while the breaker is open")
+}
+
+func TestHTTPConceptResolverTimeout(t *testing.T) {
+	stub := &conceptsAPIStub{delay: 500 * time.Millisecond}
+	resolver := newHTTPConceptResolver(startStubServer(stub, t)+"/concepts/", 100*time.Millisecond, 10, time.Minute)
+
+	_, err := resolver.exists(context.Background(), knownConceptUUID)
+	assert.Error(t, err, "Slow responses should time out")
+}
+
+func TestResolveConceptsPolicies(t *testing.T) {
+	body := `{"id":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+		{"id":"http://api.ft.com/things/` + knownConceptUUID + `","predicate":"http://www.ft.com/ontology/annotation/about"},
+		{"id":"http://api.ft.com/things/` + unknownConceptUUID + `","predicate":"http://www.ft.com/ontology/annotation/mentions"}]}`
+
+	tests := []struct {
+		policy          string
+		failing         bool
+		expectedIsErr   bool
+		expectedContent string
+	}{
+		{
+			dropUnknownConcepts, false, false,
+			`{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+				{"id":"http://api.ft.com/things/` + knownConceptUUID + `","predicate":"about","relevanceScore":0.9,"confidenceScore":0.9}]}`,
+		},
+		{
+			keepUnknownConcepts, false, false,
+			`{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+				{"id":"http://api.ft.com/things/` + knownConceptUUID + `","predicate":"about","relevanceScore":0.9,"confidenceScore":0.9},
+				{"id":"http://api.ft.com/things/` + unknownConceptUUID + `","predicate":"mentions","relevanceScore":0.9,"confidenceScore":0.9}]}`,
+		},
+		{failUnknownConcepts, false, true, ""},
+		{
+			failUnknownConcepts, true, false,
+			`{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+				{"id":"http://api.ft.com/things/` + knownConceptUUID + `","predicate":"about","relevanceScore":0.9,"confidenceScore":0.9},
+				{"id":"http://api.ft.com/things/` + unknownConceptUUID + `","predicate":"mentions","relevanceScore":0.9,"confidenceScore":0.9}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		stub := &conceptsAPIStub{}
+		resolver := newHTTPConceptResolver(startStubServer(stub, t)+"/concepts/", 100*time.Millisecond, 10, time.Minute)
+		if test.failing {
+			stub.status = http.StatusInternalServerError
+		}
+		vm := videoMapper{
+			sc:         serviceConfig{conceptResolver: resolver, unknownConceptPolicy: test.policy},
+			strContent: body,
+			log:        getLogger(),
+		}
+		require.NoError(t, vm.unmarshal(context.Background()))
+
+		output, _, err := vm.mapNextVideoAnnotations(context.Background())
+		assert.Equal(t, test.expectedIsErr, err != nil, "Error status is wrong. Policy: %s, failing: %v", test.policy, test.failing)
+		if test.expectedIsErr {
+			assert.Equal(t, codeUnknownConcept, toMappingError(err).Code)
+			continue
+		}
+		assert.JSONEq(t, test.expectedContent, string(output), "Mapped content is wrong. Policy: %s, failing: %v", test.policy, test.failing)
+	}
+}
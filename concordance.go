@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	uppAuthority          = "http://api.ft.com/system/UPP"
+	concordanceBatchSize  = 50
+	concordanceBreakerMax = 5
+)
+
+// concordanceResolver finds the canonical UUIDs of concepts which were concorded into other concepts.
+type concordanceResolver interface {
+	// canonicalUUIDs returns the canonical UUID of each of the given concept UUIDs, which is the UUID itself when it is not concorded.
+	canonicalUUIDs(ctx context.Context, conceptUUIDs []string) (map[string]string, error)
+}
+
+// httpConcordanceResolver looks the concepts up in batches on an HTTP concordances endpoint with the interface of the UPP
+// public concordances API: GET <url>?authority=http://api.ft.com/system/UPP&identifierValue=<uuid>&identifierValue=<uuid>
+// responds with the concordances of the canonical concepts of the given UUIDs. The lookups are cached.
+type httpConcordanceResolver struct {
+	url     string
+	lookups *cachedLookup
+}
+
+type concordancesResponse struct {
+	Concordances []struct {
+		Concept struct {
+			ID string `json:"id"`
+		} `json:"concept"`
+		Identifier struct {
+			Authority       string `json:"authority"`
+			IdentifierValue string `json:"identifierValue"`
+		} `json:"identifier"`
+	} `json:"concordances"`
+}
+
+func newHTTPConcordanceResolver(url string, timeout time.Duration, cacheSize int, cacheTTL time.Duration) *httpConcordanceResolver {
+	return &httpConcordanceResolver{
+		url:     url,
+		lookups: newCachedLookup(timeout, cacheSize, cacheTTL, concordanceBreakerMax, concordanceLookups),
+	}
+}
+
+func (r *httpConcordanceResolver) canonicalUUIDs(ctx context.Context, conceptUUIDs []string) (map[string]string, error) {
+	result := make(map[string]string, len(conceptUUIDs))
+	var missing []string
+	for _, conceptUUID := range conceptUUIDs {
+		if canonical, ok := r.lookups.cached(conceptUUID); ok {
+			result[conceptUUID] = canonical.(string)
+			continue
+		}
+		missing = append(missing, conceptUUID)
+	}
+
+	for start := 0; start < len(missing); start += concordanceBatchSize {
+		end := start + concordanceBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := missing[start:end]
+
+		var canonicals map[string]string
+		err := r.lookups.call(len(batch), func() error {
+			var err error
+			canonicals, err = r.lookup(ctx, batch)
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+
+		for _, conceptUUID := range batch {
+			canonical, concorded := canonicals[conceptUUID]
+			if !concorded {
+				canonical = conceptUUID
+			}
+			lookupResult := lookupRewritten
+			if canonical == conceptUUID {
+				lookupResult = lookupUnchanged
+			}
+			r.lookups.store(conceptUUID, canonical, lookupResult)
+			result[conceptUUID] = canonical
+		}
+	}
+	return result, nil
+}
+
+func (r *httpConcordanceResolver) lookup(ctx context.Context, conceptUUIDs []string) (map[string]string, error) {
+	query := url.Values{"authority": {uppAuthority}, "identifierValue": conceptUUIDs}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	injectHTTPTraceContext(ctx, req.Header)
+
+	resp, err := r.lookups.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return map[string]string{}, nil
+	default:
+		return nil, fmt.Errorf("concordances endpoint responded with status %d", resp.StatusCode)
+	}
+
+	var body concordancesResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("concordances endpoint response couldn't be decoded: %w", err)
+	}
+	canonicals := make(map[string]string)
+	for _, c := range body.Concordances {
+		if c.Identifier.Authority != uppAuthority {
+			continue
+		}
+		matches := conceptIDPattern.FindStringSubmatch(c.Concept.ID)
+		if matches == nil {
+			continue
+		}
+		canonicals[strings.ToLower(c.Identifier.IdentifierValue)] = strings.ToLower(matches[1])
+	}
+	return canonicals, nil
+}
+
+// canonicaliseConcepts rewrites the concept IDs of the annotations to the IDs of their canonical concepts,
+// remembering the original ID of each rewritten annotation. Annotations which become duplicates after the rewrite are dropped.
+// When the concordances cannot be looked up, the annotations are kept unchanged.
+func (vm *videoMapper) canonicaliseConcepts(ctx context.Context, annotations []tag, videoUUID string) []tag {
+	if vm.sc.concordanceResolver == nil {
+		return annotations
+	}
+	ctx, span := startSpan(ctx, "canonicaliseConcepts")
+	defer span.End()
+
+	var conceptUUIDs []string
+	requested := make(map[string]bool)
+	for _, ann := range annotations {
+		if matches := conceptIDPattern.FindStringSubmatch(ann.thingID); matches != nil {
+			conceptUUID := strings.ToLower(matches[1])
+			if !requested[conceptUUID] {
+				requested[conceptUUID] = true
+				conceptUUIDs = append(conceptUUIDs, conceptUUID)
+			}
+		}
+	}
+	if len(conceptUUIDs) == 0 {
+		return annotations
+	}
+
+	canonicals, err := vm.sc.concordanceResolver.canonicalUUIDs(ctx, conceptUUIDs)
+	if err != nil {
+		recordSpanError(span, err)
+		vm.log.WithTransactionID(vm.tid).
+			WithUUID(videoUUID).
+			WithError(err).
+			Warn("Could not look up the concordances of the annotated concepts, keeping the original concept IDs")
+	}
+
+	result := make([]tag, 0, len(annotations))
+	seen := make(map[tag]bool)
+	for _, ann := range annotations {
+		originalID := ""
+		if matches := conceptIDPattern.FindStringSubmatch(ann.thingID); matches != nil {
+			canonical, found := canonicals[strings.ToLower(matches[1])]
+			if found && thingsURIPrefix+canonical != ann.thingID {
+				canonicalID := thingsURIPrefix + canonical
+				if conceptType, known := vm.conceptTypes[ann.thingID]; known {
+					vm.conceptTypes[canonicalID] = conceptType
+				}
+				originalID = ann.thingID
+				ann.thingID = canonicalID
+			}
+		}
+		if seen[ann] {
+			vm.quality.duplicate(true)
+			continue
+		}
+		seen[ann] = true
+		if originalID != "" {
+			vm.originalIDs[ann] = originalID
+		}
+		result = append(result, ann)
+	}
+	return result
+}
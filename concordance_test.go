@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	concordedConceptUUID = "b43f1a91-b805-3453-8c36-1d164c047ca2"
+	canonicalConceptUUID = "71a5efa5-e6e0-3ce1-9190-a7eac8bef325"
+)
+
+// concordancesAPIStub stands in for the concordances endpoint, knowing that concordedConceptUUID was concorded into canonicalConceptUUID.
+type concordancesAPIStub struct {
+	mu       sync.Mutex
+	requests [][]string
+	failing  bool
+}
+
+func (s *concordancesAPIStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ids := r.URL.Query()["identifierValue"]
+	s.mu.Lock()
+	s.requests = append(s.requests, ids)
+	failing := s.failing
+	s.mu.Unlock()
+
+	if failing || r.URL.Query().Get("authority") != uppAuthority {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var concordances []map[string]interface{}
+	for _, id := range ids {
+		canonical := id
+		if id == concordedConceptUUID {
+			canonical = canonicalConceptUUID
+		}
+		concordances = append(concordances, map[string]interface{}{
+			"concept":    map[string]string{"id": "http://api.ft.com/things/" + canonical},
+			"identifier": map[string]string{"authority": uppAuthority, "identifierValue": id},
+		})
+	}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"concordances": concordances})
+}
+
+func (s *concordancesAPIStub) requestedIDs() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// concordanceResolverFunc adapts a function to the concordanceResolver interface.
+type concordanceResolverFunc func(ctx context.Context, conceptUUIDs []string) (map[string]string, error)
+
+func (f concordanceResolverFunc) canonicalUUIDs(ctx context.Context, conceptUUIDs []string) (map[string]string, error) {
+	return f(ctx, conceptUUIDs)
+}
+
+func TestHTTPConcordanceResolver(t *testing.T) {
+	stub := &concordancesAPIStub{}
+	resolver := newHTTPConcordanceResolver(startStubServer(stub, t)+"/concordances", time.Second, 1000, time.Minute)
+
+	canonicals, err := resolver.canonicalUUIDs(context.Background(), []string{concordedConceptUUID, canonicalConceptUUID})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		concordedConceptUUID: canonicalConceptUUID,
+		canonicalConceptUUID: canonicalConceptUUID,
+	}, canonicals)
+
+	_, err = resolver.canonicalUUIDs(context.Background(), []string{concordedConceptUUID})
+	require.NoError(t, err)
+	assert.Len(t, stub.requestedIDs(), 1, "The concordances should be cached")
+}
+
+func TestHTTPConcordanceResolverBatches(t *testing.T) {
+	stub := &concordancesAPIStub{}
+	resolver := newHTTPConcordanceResolver(startStubServer(stub, t)+"/concordances", time.Second, 1000, time.Minute)
+
+	var conceptUUIDs []string
+	for i := 0; i < concordanceBatchSize+1; i++ {
+		conceptUUIDs = append(conceptUUIDs, fmt.Sprintf("00000000-0000-0000-0000-%012d", i))
+	}
+	canonicals, err := resolver.canonicalUUIDs(context.Background(), conceptUUIDs)
+	require.NoError(t, err)
+	assert.Len(t, canonicals, len(conceptUUIDs))
+
+	requests := stub.requestedIDs()
+	require.Len(t, requests, 2)
+	assert.Len(t, requests[0], concordanceBatchSize)
+	assert.Len(t, requests[1], 1)
+}
+
+func TestCanonicaliseConceptsRecordsTheOriginalIDOfEachAnnotation(t *testing.T) {
+	const otherConcordedUUID = "c2acc00f-5ad6-3f79-b6bb-d51dcd81508a"
+	canonicals := map[string]string{concordedConceptUUID: canonicalConceptUUID, otherConcordedUUID: canonicalConceptUUID}
+	resolver := concordanceResolverFunc(func(_ context.Context, conceptUUIDs []string) (map[string]string, error) {
+		assert.ElementsMatch(t, []string{concordedConceptUUID, otherConcordedUUID}, conceptUUIDs, "Each concept should be looked up once")
+		return canonicals, nil
+	})
+	vm := videoMapper{sc: serviceConfig{concordanceResolver: resolver}, quality: newQualityReport("", 4), originalIDs: make(map[tag]string), log: getLogger()}
+
+	annotations := vm.canonicaliseConcepts(context.Background(), []tag{
+		{"http://api.ft.com/things/" + otherConcordedUUID, "mentions"},
+		{"http://api.ft.com/things/" + concordedConceptUUID, "about"},
+		{"http://api.ft.com/things/" + otherConcordedUUID, "about"},
+		{"http://api.ft.com/things/" + concordedConceptUUID, "mentions"},
+	}, "e2290d14-7e80-4db8-a715-949da4de9a07")
+
+	canonicalID := "http://api.ft.com/things/" + canonicalConceptUUID
+	assert.Equal(t, []tag{{canonicalID, "mentions"}, {canonicalID, "about"}}, annotations)
+	assert.Equal(t, map[tag]string{
+		{canonicalID, "mentions"}: "http://api.ft.com/things/" + otherConcordedUUID,
+		{canonicalID, "about"}:    "http://api.ft.com/things/" + concordedConceptUUID,
+	}, vm.originalIDs, "Each annotation should keep the original ID of the annotation it was rewritten from")
+}
+
+func TestCanonicaliseConcepts(t *testing.T) {
+	body := `{"id":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+		{"id":"http://api.ft.com/things/` + concordedConceptUUID + `","predicate":"http://www.ft.com/ontology/annotation/about"},
+		{"id":"http://api.ft.com/things/` + canonicalConceptUUID + `","predicate":"http://www.ft.com/ontology/annotation/about"},
+		{"id":"http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740","predicate":"http://www.ft.com/ontology/annotation/mentions"}]}`
+
+	tests := []struct {
+		failing         bool
+		expectedContent string
+	}{
+		{
+			false,
+			`{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+				{"id":"http://api.ft.com/things/` + canonicalConceptUUID + `","predicate":"about","relevanceScore":0.9,"confidenceScore":0.9,
+				 "originalId":"http://api.ft.com/things/` + concordedConceptUUID + `"},
+				{"id":"http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740","predicate":"mentions","relevanceScore":0.9,"confidenceScore":0.9}]}`,
+		},
+		{
+			true,
+			`{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+				{"id":"http://api.ft.com/things/` + concordedConceptUUID + `","predicate":"about","relevanceScore":0.9,"confidenceScore":0.9},
+				{"id":"http://api.ft.com/things/` + canonicalConceptUUID + `","predicate":"about","relevanceScore":0.9,"confidenceScore":0.9},
+				{"id":"http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740","predicate":"mentions","relevanceScore":0.9,"confidenceScore":0.9}]}`,
+		},
+	}
+
+	for _, test := range tests {
+		stub := &concordancesAPIStub{}
+		resolver := newHTTPConcordanceResolver(startStubServer(stub, t)+"/concordances", time.Second, 1000, time.Minute)
+		stub.failing = test.failing
+		vm := videoMapper{
+			sc:         serviceConfig{concordanceResolver: resolver},
+			strContent: body,
+			log:        getLogger(),
+		}
+		require.NoError(t, vm.unmarshal(context.Background()))
+
+		output, _, err := vm.mapNextVideoAnnotations(context.Background())
+		require.NoError(t, err)
+		assert.JSONEq(t, test.expectedContent, string(output), "Mapped content is wrong. Failing endpoint: %v", test.failing)
+		assert.Len(t, stub.requestedIDs(), 1, "All the concepts should be looked up in a single batch")
+		if !test.failing {
+			assert.Equal(t, 1, vm.quality.Duplicates, "The concept which became a duplicate should be reported")
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+const (
+	consumptionBreakerThreshold   = 3
+	consumptionBreakerCooldown    = 5 * time.Second
+	consumptionBreakerMaxCooldown = 2 * time.Minute
+)
+
+var errConsumptionPaused = errors.New("consumption is paused while the write queue is unavailable")
+
+// consumptionBreaker pauses the consumption of the read queue while the messages cannot be produced:
+// after the failures of several messages in a row, or straight away when a failure comes with an unhealthy producer.
+// A message failing again when it is delivered again is only counted once, so a single poison message can't pause the consumption.
+// While it is open the consumed message is not handled but delivered again, so no further messages are read.
+// Once the cooldown is over the producer is probed and, if it is reachable, a single message is handled as a trial
+// which resumes the consumption when it succeeds. The cooldown doubles with every failed probe.
+type consumptionBreaker struct {
+	breaker  *circuitBreaker
+	producer messageProducerHealthcheck
+	log      *logger.UPPLogger
+
+	mu sync.Mutex
+	// failed holds the fingerprints of the messages which failed since the last success
+	failed map[string]bool
+}
+
+func newConsumptionBreaker(producer messageProducerHealthcheck, log *logger.UPPLogger) *consumptionBreaker {
+	cb := &consumptionBreaker{
+		breaker:  newCircuitBreaker(consumptionBreakerThreshold, consumptionBreakerCooldown).withBackoff(consumptionBreakerMaxCooldown),
+		producer: producer,
+		log:      log,
+		failed:   make(map[string]bool),
+	}
+	cb.recordState()
+	return cb
+}
+
+// guard wraps a message handler, handling the messages only while the breaker allows it.
+func (c *consumptionBreaker) guard(handler func(Message) error) func(Message) error {
+	return func(m Message) error {
+		if !c.breaker.allow() {
+			return errConsumptionPaused
+		}
+		if c.state() == breakerHalfOpen {
+			c.recordState()
+			if err := c.producer.ConnectivityCheck(); err != nil {
+				c.failure()
+				return fmt.Errorf("%w: %v", errConsumptionPaused, err)
+			}
+		}
+
+		if err := handler(m); err != nil {
+			if probeErr := c.producer.ConnectivityCheck(); probeErr != nil {
+				c.trip(probeErr)
+			} else if c.firstFailure(m) || c.state() == breakerHalfOpen {
+				c.failure()
+			}
+			return err
+		}
+		c.success()
+		return nil
+	}
+}
+
+func (c *consumptionBreaker) state() string {
+	return c.breaker.currentState()
+}
+
+// firstFailure records the failure of the message, telling whether it is the first one since the last success.
+func (c *consumptionBreaker) firstFailure(m Message) bool {
+	fingerprint := messageFingerprint(m)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failed[fingerprint] {
+		return false
+	}
+	c.failed[fingerprint] = true
+	return true
+}
+
+func (c *consumptionBreaker) success() {
+	c.mu.Lock()
+	c.failed = make(map[string]bool)
+	c.mu.Unlock()
+
+	wasPaused := c.state() != breakerClosed
+	c.breaker.success()
+	c.recordState()
+	if wasPaused {
+		c.log.Info("Write queue is available again, resuming consumption")
+	}
+}
+
+func (c *consumptionBreaker) failure() {
+	wasClosed := c.state() == breakerClosed
+	c.breaker.failure()
+	c.recordState()
+	if wasClosed && c.state() == breakerOpen {
+		consumptionPauses.Inc()
+		c.log.Warn("Repeated failures to produce messages, pausing consumption")
+	}
+}
+
+func (c *consumptionBreaker) trip(err error) {
+	wasClosed := c.state() == breakerClosed
+	c.breaker.trip()
+	c.recordState()
+	if wasClosed {
+		consumptionPauses.Inc()
+		c.log.WithError(err).Warn("Write queue is unavailable, pausing consumption")
+	}
+}
+
+func (c *consumptionBreaker) recordState() {
+	current := c.state()
+	for _, s := range []string{breakerClosed, breakerOpen, breakerHalfOpen} {
+		value := 0.0
+		if s == current {
+			value = 1
+		}
+		consumptionBreakerState.WithLabelValues(s).Set(value)
+	}
+}
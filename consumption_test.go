@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumptionBreakerPausesAfterProduceFailures(t *testing.T) {
+	producer := &mockProducerInstance{isConnectionHealthy: true}
+	cb := newConsumptionBreaker(producer, getLogger())
+	now := time.Now()
+	cb.breaker.now = func() time.Time { return now }
+
+	handled := 0
+	failing := true
+	guarded := cb.guard(func(Message) error {
+		handled++
+		if failing {
+			return errors.New("produce failed")
+		}
+		return nil
+	})
+
+	for i := 0; i < consumptionBreakerThreshold; i++ {
+		assert.Error(t, guarded(Message{Headers: map[string]string{"Message-Id": strconv.Itoa(i)}}))
+	}
+	assert.Equal(t, breakerOpen, cb.state(), "The failures of several messages in a row should pause consumption")
+
+	err := guarded(Message{})
+	assert.ErrorIs(t, err, errConsumptionPaused)
+	assert.Equal(t, consumptionBreakerThreshold, handled, "No message should be handled while consumption is paused")
+
+	failing = false
+	now = now.Add(consumptionBreakerCooldown)
+	assert.NoError(t, guarded(Message{}))
+	assert.Equal(t, breakerClosed, cb.state(), "A successful trial message should resume consumption")
+}
+
+func TestConsumptionBreakerCountsTheRedeliveriesOfAMessageOnce(t *testing.T) {
+	cb := newConsumptionBreaker(&mockProducerInstance{isConnectionHealthy: true}, getLogger())
+	guarded := cb.guard(func(Message) error { return errors.New("message too large") })
+
+	for i := 0; i < 2*consumptionBreakerThreshold; i++ {
+		assert.Error(t, guarded(Message{Headers: map[string]string{"Message-Id": "poison"}}))
+	}
+	assert.Equal(t, breakerClosed, cb.state(), "A single poison message should not pause consumption")
+}
+
+func TestConsumptionBreakerPausesOnUnhealthyProducer(t *testing.T) {
+	producer := &mockProducerInstance{isConnectionHealthy: false}
+	cb := newConsumptionBreaker(producer, getLogger())
+	now := time.Now()
+	cb.breaker.now = func() time.Time { return now }
+
+	handled := 0
+	guarded := cb.guard(func(Message) error {
+		handled++
+		return errors.New("produce failed")
+	})
+
+	assert.Error(t, guarded(Message{}))
+	assert.Equal(t, breakerOpen, cb.state(), "A produce failure with an unhealthy producer should pause consumption straight away")
+
+	now = now.Add(consumptionBreakerCooldown)
+	assert.ErrorIs(t, guarded(Message{}), errConsumptionPaused, "The message should not be handled while the probe fails")
+	assert.Equal(t, 1, handled)
+	assert.Equal(t, breakerOpen, cb.state())
+
+	producer.isConnectionHealthy = true
+	now = now.Add(consumptionBreakerCooldown)
+	assert.ErrorIs(t, guarded(Message{}), errConsumptionPaused, "The cooldown should double after a failed probe")
+
+	now = now.Add(consumptionBreakerCooldown)
+	assert.Error(t, guarded(Message{}))
+	assert.Equal(t, 2, handled, "A trial message should be handled once the probe succeeds")
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"time"
+)
+
+// Headers describing why a message was dead-lettered.
+const (
+	errorCodeHeader      = "X-Error-Code"
+	errorSeverityHeader  = "X-Error-Severity"
+	errorFieldHeader     = "X-Error-Field"
+	errorMessageHeader   = "X-Error-Message"
+	deadLetterTimeHeader = "X-Dead-Letter-Timestamp"
+)
+
+// newDeadLetterMessage returns a copy of the original message annotated with the reason it could not be mapped.
+func newDeadLetterMessage(m Message, me *mappingError) Message {
+	headers := make(map[string]string, len(m.Headers)+5)
+	for k, v := range m.Headers {
+		headers[k] = v
+	}
+	headers[errorCodeHeader] = me.Code
+	headers[errorSeverityHeader] = me.Severity
+	headers[errorFieldHeader] = me.Field
+	headers[errorMessageHeader] = me.Message
+	headers[deadLetterTimeHeader] = time.Now().Format(dateFormat)
+
+	return Message{Headers: headers, Body: m.Body}
+}
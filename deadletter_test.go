@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDeadLetterMessage(t *testing.T) {
+	original := Message{Headers: createHeaders(nextVideoOrigin, "tid_1"), Body: "not json"}
+	me := newMappingError(codeInvalidJSON, "", "invalid JSON")
+
+	dlm := newDeadLetterMessage(original, me)
+
+	assert.Equal(t, original.Body, dlm.Body)
+	assert.Equal(t, "tid_1", dlm.Headers["X-Request-Id"])
+	assert.Equal(t, nextVideoOrigin, dlm.Headers["Origin-System-Id"])
+	assert.Equal(t, codeInvalidJSON, dlm.Headers[errorCodeHeader])
+	assert.Equal(t, severityError, dlm.Headers[errorSeverityHeader])
+	assert.Equal(t, "invalid JSON", dlm.Headers[errorMessageHeader])
+	assert.NotEmpty(t, dlm.Headers[deadLetterTimeHeader])
+	assert.NotContains(t, original.Headers, errorCodeHeader, "The original headers should not be modified")
+}
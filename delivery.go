@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+const (
+	initialRedeliveryBackoff = 500 * time.Millisecond
+	maxRedeliveryBackoff     = 30 * time.Second
+	defaultMaxRedeliveries   = 50
+)
+
+var errRedeliveriesExhausted = errors.New("message was not handled within the maximum number of redeliveries")
+
+// redelivery hands a message to the handler again, with an exponential backoff, until it is handled or its redeliveries are exhausted.
+type redelivery struct {
+	initialBackoff  time.Duration
+	maxBackoff      time.Duration
+	maxRedeliveries int
+	log             *logger.UPPLogger
+}
+
+func newRedelivery(maxRedeliveries int, log *logger.UPPLogger) redelivery {
+	return redelivery{
+		initialBackoff:  initialRedeliveryBackoff,
+		maxBackoff:      maxRedeliveryBackoff,
+		maxRedeliveries: maxRedeliveries,
+		log:             log,
+	}
+}
+
+// deliver returns nil once the message is handled, the error of ctx once it is done, or errRedeliveriesExhausted.
+func (r redelivery) deliver(ctx context.Context, handler func(Message) error, m Message) error {
+	backoff := r.initialBackoff
+	redeliveries := 0
+	for {
+		err := handler(m)
+		if err == nil {
+			return nil
+		}
+
+		// the deliveries made while the consumption is paused fail because of the write queue, so they are not counted
+		if errors.Is(err, errConsumptionPaused) {
+			r.log.WithTransactionID(m.Headers["X-Request-Id"]).
+				WithError(err).
+				Debugf("Consumption is paused, delivering the message again in %s", backoff)
+		} else {
+			if r.maxRedeliveries > 0 && redeliveries >= r.maxRedeliveries {
+				consumedMessages.WithLabelValues(outcomeAbandoned).Inc()
+				r.log.WithTransactionID(m.Headers["X-Request-Id"]).
+					WithError(err).
+					Errorf("Message was not handled after %d redeliveries, giving up on it", redeliveries)
+				return fmt.Errorf("%w: %v", errRedeliveriesExhausted, err)
+			}
+			redeliveries++
+			redeliveredMessages.Inc()
+			r.log.WithTransactionID(m.Headers["X-Request-Id"]).
+				WithError(err).
+				Warnf("Message was not handled, delivering it again in %s", backoff)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
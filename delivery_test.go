@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRedelivery() redelivery {
+	return redelivery{initialBackoff: time.Millisecond, maxBackoff: 4 * time.Millisecond, log: getLogger()}
+}
+
+func TestRedeliveryRetriesUntilHandled(t *testing.T) {
+	attempts := 0
+	handler := func(Message) error {
+		attempts++
+		if attempts < 4 {
+			return errors.New("produce failed")
+		}
+		return nil
+	}
+
+	err := newTestRedelivery().deliver(context.Background(), handler, Message{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, attempts)
+}
+
+func TestRedeliveryStopsWhenClosed(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	attempts := 0
+	handler := func(Message) error {
+		attempts++
+		if attempts == 2 {
+			cancel()
+		}
+		return errors.New("produce failed")
+	}
+
+	err := newTestRedelivery().deliver(ctx, handler, Message{})
+	assert.ErrorIs(t, err, context.Canceled, "A message which was never handled should not be reported as handled")
+	assert.Equal(t, 2, attempts)
+}
+
+func TestRedeliveryGivesUpAfterMaxRedeliveries(t *testing.T) {
+	r := newTestRedelivery()
+	r.maxRedeliveries = 3
+	attempts := 0
+	handler := func(Message) error {
+		attempts++
+		return errors.New("produce failed")
+	}
+	before := testutil.ToFloat64(consumedMessages.WithLabelValues(outcomeAbandoned))
+
+	err := r.deliver(context.Background(), handler, Message{})
+	assert.ErrorIs(t, err, errRedeliveriesExhausted)
+	assert.Equal(t, 4, attempts, "The message should be delivered once and then again up to the maximum")
+	assert.Equal(t, before+1, testutil.ToFloat64(consumedMessages.WithLabelValues(outcomeAbandoned)))
+}
+
+func TestRedeliveryDoesNotCountPausedDeliveries(t *testing.T) {
+	r := newTestRedelivery()
+	r.maxRedeliveries = 1
+	attempts := 0
+	handler := func(Message) error {
+		attempts++
+		if attempts < 5 {
+			return errConsumptionPaused
+		}
+		if attempts < 6 {
+			return errors.New("produce failed")
+		}
+		return nil
+	}
+
+	err := r.deliver(context.Background(), handler, Message{})
+	assert.NoError(t, err, "The deliveries while the consumption is paused should not exhaust the redeliveries")
+	assert.Equal(t, 6, attempts)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	e2eReadTopic       = "NativeCmsMetadataPublicationEvents"
+	e2eWriteTopic      = "ConceptAnnotations"
+	e2eDeadLetterTopic = "NextVideoAnnotationsDeadLetter"
+)
+
+type e2eService struct {
+	broker   *fakeBroker
+	consumer *fakeConsumer
+	server   *httptest.Server
+}
+
+func startE2EService(t *testing.T) *e2eService {
+	t.Helper()
+	return startCoalescingE2EService(t, 0)
+}
+
+// startCoalescingE2EService starts the service coalescing the messages of a video within the window, unless it is 0.
+func startCoalescingE2EService(t *testing.T, window time.Duration) *e2eService {
+	t.Helper()
+
+	broker := newFakeBroker()
+	consumer := broker.consumer(e2eReadTopic)
+	out := outputs{
+		annotations: broker.producer(e2eWriteTopic),
+		deadLetter:  broker.producer(e2eDeadLetterTopic),
+	}
+	if window > 0 {
+		out.annotations = newCoalescingSink(out.annotations, window, 0, getLogger())
+	}
+	sc := serviceConfig{
+		serviceName:   "next-video-annotations-mapper",
+		appName:       "Next Video Annotations Mapper",
+		appSystemCode: "up-nvam",
+	}
+
+	router := startService(sc, consumer, out, getLogger())
+	server := httptest.NewServer(router)
+	t.Cleanup(func() {
+		server.Close()
+		_ = consumer.Close()
+	})
+
+	return &e2eService{broker: broker, consumer: consumer, server: server}
+}
+
+func (s *e2eService) get(t *testing.T, path string) (int, string) {
+	t.Helper()
+
+	resp, err := http.Get(s.server.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestE2EMapsNextVideoToWriteTopic(t *testing.T) {
+	s := startE2EService(t)
+
+	s.broker.publish(e2eReadTopic, Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_e2e_1"),
+		Body:    string(getBytes("next-video-input.json", t)),
+	})
+
+	msgs := s.broker.waitForMessages(t, e2eWriteTopic, 1)
+	require.Len(t, msgs, 1)
+
+	expected := newStringConceptAnnotation(t, "e2290d14-7e80-4db8-a715-949da4de9a07",
+		[]annotation{{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "isClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}},
+	)
+	assert.Equal(t, expected, msgs[0].Body)
+	assert.Equal(t, "tid_e2e_1", msgs[0].Headers["X-Request-Id"])
+	assert.Equal(t, nextVideoOrigin, msgs[0].Headers["Origin-System-Id"])
+	assert.Equal(t, generatedMsgType, msgs[0].Headers["Message-Type"])
+	assert.Equal(t, "application/json", msgs[0].Headers["Content-Type"])
+	assert.NotEmpty(t, msgs[0].Headers["Message-Id"])
+	assert.NotEmpty(t, msgs[0].Headers["Message-Timestamp"])
+}
+
+func TestE2ESkipsUnmappableMessages(t *testing.T) {
+	s := startE2EService(t)
+
+	s.broker.publish(e2eReadTopic, Message{
+		Headers: createHeaders("other", "tid_e2e_other"),
+		Body:    string(getBytes("next-video-input.json", t)),
+	})
+	s.broker.publish(e2eReadTopic, Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_e2e_invalid"),
+		Body:    string(getBytes("invalid-format.json", t)),
+	})
+	s.broker.publish(e2eReadTopic, Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_e2e_delete"),
+		Body:    string(getBytes("next-video-delete-input.json", t)),
+	})
+
+	// The delete event is the last one on the read topic, so once it is mapped the previous ones have been handled.
+	msgs := s.broker.waitForMessages(t, e2eWriteTopic, 1)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "tid_e2e_delete", msgs[0].Headers["X-Request-Id"])
+
+	var concept ConceptAnnotation
+	require.NoError(t, json.Unmarshal([]byte(msgs[0].Body), &concept))
+	assert.Equal(t, ConceptAnnotation{"e2290d14-7e80-4db8-a715-949da4de9a07", []annotation{}}, concept)
+
+	deadLetters := s.broker.waitForMessages(t, e2eDeadLetterTopic, 1)
+	require.Len(t, deadLetters, 1, "Only the invalid Next video message should be dead-lettered")
+	assert.Equal(t, "tid_e2e_invalid", deadLetters[0].Headers["X-Request-Id"])
+	assert.Equal(t, codeInvalidJSON, deadLetters[0].Headers[errorCodeHeader])
+}
+
+func TestE2ECommitsOnlyHandledMessages(t *testing.T) {
+	s := startE2EService(t)
+	s.broker.setUnreachable(true)
+
+	s.broker.publish(e2eReadTopic, Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_e2e_retry"),
+		Body:    string(getBytes("next-video-input.json", t)),
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Empty(t, s.broker.messages(e2eWriteTopic))
+	assert.Equal(t, 0, s.consumer.committedOffset(), "A message which couldn't be produced should not be committed")
+	_, body := s.get(t, "/__health")
+	assert.Contains(t, body, `"name":"Message Consumption Is Not Paused","ok":false`, "Consumption should be paused while the write queue is unreachable")
+
+	s.broker.setUnreachable(false)
+	msgs := s.broker.waitForMessages(t, e2eWriteTopic, 1)
+	assert.Equal(t, "tid_e2e_retry", msgs[0].Headers["X-Request-Id"])
+	assert.Eventually(t, func() bool { return s.consumer.committedOffset() == 1 }, time.Second, 10*time.Millisecond,
+		"The message should be committed once it is produced")
+	_, body = s.get(t, "/__health")
+	assert.Contains(t, body, `"name":"Message Consumption Is Not Paused","ok":true`, "Consumption should resume once the write queue is reachable")
+}
+
+func TestE2ECommitsDeadLetteredMessages(t *testing.T) {
+	s := startE2EService(t)
+
+	s.broker.publish(e2eReadTopic, Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_e2e_invalid"),
+		Body:    string(getBytes("invalid-format.json", t)),
+	})
+
+	s.broker.waitForMessages(t, e2eDeadLetterTopic, 1)
+	assert.Eventually(t, func() bool { return s.consumer.committedOffset() == 1 }, time.Second, 10*time.Millisecond,
+		"The message should be committed once it is dead-lettered")
+	assert.Empty(t, s.broker.messages(e2eWriteTopic))
+}
+
+func TestE2ECoalescesTheSavesOfAVideo(t *testing.T) {
+	s := startCoalescingE2EService(t, 500*time.Millisecond)
+
+	for _, tid := range []string{"tid_e2e_save_1", "tid_e2e_save_2", "tid_e2e_save_3"} {
+		s.broker.publish(e2eReadTopic, Message{
+			Headers: createHeaders(nextVideoOrigin, tid),
+			Body:    string(getBytes("next-video-input.json", t)),
+		})
+	}
+
+	assert.Eventually(t, func() bool { return s.consumer.committedOffset() == 2 }, time.Second, 10*time.Millisecond,
+		"The replaced saves should be committed without waiting for the window")
+	assert.Empty(t, s.broker.messages(e2eWriteTopic), "The newest save should be held until the window is over")
+
+	msgs := s.broker.waitForMessages(t, e2eWriteTopic, 1)
+	assert.Equal(t, "tid_e2e_save_3", msgs[0].Headers["X-Request-Id"])
+	assert.Eventually(t, func() bool { return s.consumer.committedOffset() == 3 }, time.Second, 10*time.Millisecond,
+		"The newest save should be committed once it is sent")
+	assert.Len(t, s.broker.messages(e2eWriteTopic), 1, "Only the newest save should be sent")
+}
+
+func TestE2EHealthReflectsBroker(t *testing.T) {
+	s := startE2EService(t)
+
+	status, body := s.get(t, "/__health")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"name":"Read Message Queue Reachable","ok":true`)
+	assert.Contains(t, body, `"name":"Write Message Queue Reachable","ok":true`)
+
+	status, _ = s.get(t, "/__gtg")
+	assert.Equal(t, http.StatusOK, status)
+
+	s.broker.setLagging(true)
+	_, body = s.get(t, "/__health")
+	assert.Contains(t, body, `"name":"Read Message Queue Is Not Lagging","ok":false`)
+	assert.Contains(t, body, `"name":"Read Message Queue Reachable","ok":true`)
+
+	s.broker.setUnreachable(true)
+	_, body = s.get(t, "/__health")
+	assert.Contains(t, body, `"name":"Read Message Queue Reachable","ok":false`)
+	assert.Contains(t, body, `"name":"Write Message Queue Reachable","ok":false`)
+
+	status, _ = s.get(t, "/__gtg")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestE2EMapEndpoint(t *testing.T) {
+	s := startE2EService(t)
+
+	req, err := http.NewRequest(http.MethodPost, s.server.URL+"/map", strings.NewReader(string(getBytes("next-video-input.json", t))))
+	require.NoError(t, err)
+	req.Header.Set("X-Request-Id", "tid_e2e_map")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07"`)
+	assert.Empty(t, s.broker.messages(e2eWriteTopic), "The /map endpoint should not produce messages")
+}
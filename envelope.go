@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Envelope formats of the consumed messages.
+const (
+	autoEnvelope    = "auto"
+	rawEnvelope     = "raw"
+	payloadEnvelope = "payload"
+
+	// envelopeHeader names the envelope format of a message, overriding the configured one.
+	envelopeHeader = "X-Envelope-Format"
+)
+
+// envelopeDecoder extracts the Next video document from a message body wrapped in an envelope.
+type envelopeDecoder func(body []byte) ([]byte, error)
+
+// envelopeDecoders holds the decoders of the known envelope formats by name.
+var envelopeDecoders = map[string]envelopeDecoder{
+	rawEnvelope:     decodeRawEnvelope,
+	payloadEnvelope: decodePayloadEnvelope,
+}
+
+func isEnvelopeFormat(format string) bool {
+	_, ok := envelopeDecoders[format]
+	return ok || format == autoEnvelope
+}
+
+// decodeRawEnvelope is the decoder of the messages whose body is the Next video document itself.
+func decodeRawEnvelope(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+// decodePayloadEnvelope is the decoder of the UPP native publication events, which carry the Next video document under
+// the payload key next to contentUri and lastModified. The payload may also be the document encoded as a JSON string.
+func decodePayloadEnvelope(body []byte) ([]byte, error) {
+	var envelope struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, err
+	}
+	payload := bytes.TrimSpace(envelope.Payload)
+	if len(payload) == 0 || bytes.Equal(payload, []byte("null")) {
+		return nil, fmt.Errorf("envelope has no payload")
+	}
+	if payload[0] == '"' {
+		var encoded string
+		if err := json.Unmarshal(payload, &encoded); err != nil {
+			return nil, err
+		}
+		return []byte(encoded), nil
+	}
+	return payload, nil
+}
+
+// detectEnvelope recognises the payload envelope by its payload key next to contentUri or lastModified.
+// Anything else, including invalid JSON, is taken as a raw Next video document.
+func detectEnvelope(body []byte) string {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return rawEnvelope
+	}
+	if _, ok := fields["payload"]; !ok {
+		return rawEnvelope
+	}
+	_, hasContentURI := fields["contentUri"]
+	_, hasLastModified := fields["lastModified"]
+	if hasContentURI || hasLastModified {
+		return payloadEnvelope
+	}
+	return rawEnvelope
+}
+
+// unwrapEnvelope extracts the Next video document from the body, using the decoder of the given format
+// or of the detected one in auto mode.
+func unwrapEnvelope(body []byte, format string) ([]byte, string, error) {
+	if format == "" || format == autoEnvelope {
+		format = detectEnvelope(body)
+	}
+	decode, ok := envelopeDecoders[format]
+	if !ok {
+		return nil, format, fmt.Errorf("unknown envelope format %q", format)
+	}
+	document, err := decode(body)
+	return document, format, err
+}
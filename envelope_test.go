@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func payloadEnvelopeOf(t *testing.T, document []byte, encodeAsString bool) []byte {
+	payload := json.RawMessage(document)
+	if encodeAsString {
+		encoded, err := json.Marshal(string(document))
+		require.NoError(t, err)
+		payload = encoded
+	}
+	envelope, err := json.Marshal(map[string]interface{}{
+		"contentUri":   "http://next-video-mapper.svc.ft.com/video/model/e2290d14-7e80-4db8-a715-949da4de9a07",
+		"lastModified": "2017-04-04T14:42:58.920Z",
+		"payload":      payload,
+	})
+	require.NoError(t, err)
+	return envelope
+}
+
+func TestUnwrapEnvelope(t *testing.T) {
+	document := getBytes("next-video-input.json", t)
+
+	tests := []struct {
+		name           string
+		body           []byte
+		format         string
+		expectedFormat string
+	}{
+		{"raw document detected", document, autoEnvelope, rawEnvelope},
+		{"raw document configured", document, rawEnvelope, rawEnvelope},
+		{"no format means auto", document, "", rawEnvelope},
+		{"payload object detected", payloadEnvelopeOf(t, document, false), autoEnvelope, payloadEnvelope},
+		{"payload string detected", payloadEnvelopeOf(t, document, true), autoEnvelope, payloadEnvelope},
+		{"payload object configured", payloadEnvelopeOf(t, document, false), payloadEnvelope, payloadEnvelope},
+	}
+
+	for _, test := range tests {
+		unwrapped, format, err := unwrapEnvelope(test.body, test.format)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, test.expectedFormat, format, test.name)
+		assert.JSONEq(t, string(document), string(unwrapped), test.name)
+	}
+}
+
+func TestUnwrapEnvelopeErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		format string
+	}{
+		{"null payload", `{"contentUri": "http://example.com", "payload": null}`, autoEnvelope},
+		{"missing payload", `{"uuid": "e2290d14-7e80-4db8-a715-949da4de9a07"}`, payloadEnvelope},
+		{"invalid envelope JSON", `{"payload": `, payloadEnvelope},
+		{"unknown format", `{}`, "protobuf"},
+	}
+
+	for _, test := range tests {
+		_, _, err := unwrapEnvelope([]byte(test.body), test.format)
+		assert.Error(t, err, test.name)
+	}
+
+	// a payload which is not an object is handed over as it is, to be rejected by the mapping
+	unwrapped, _, err := unwrapEnvelope([]byte(`{"lastModified": "2017-04-04T14:42:58.920Z", "payload": 12}`), autoEnvelope)
+	require.NoError(t, err)
+	assert.Equal(t, "12", string(unwrapped))
+}
+
+func TestDetectEnvelope(t *testing.T) {
+	assert.Equal(t, rawEnvelope, detectEnvelope([]byte(`not json`)))
+	assert.Equal(t, rawEnvelope, detectEnvelope([]byte(`{"payload": {}}`)), "A payload key alone should not be taken for an envelope")
+	assert.Equal(t, payloadEnvelope, detectEnvelope([]byte(`{"contentUri": "http://example.com", "payload": {}}`)))
+	assert.Equal(t, payloadEnvelope, detectEnvelope([]byte(`{"lastModified": "2017-04-04T14:42:58.920Z", "payload": {}}`)))
+}
+
+func TestQueueConsumeUnwrapsEnvelopes(t *testing.T) {
+	document := getBytes("next-video-input.json", t)
+	expected := newStringConceptAnnotation(t, "e2290d14-7e80-4db8-a715-949da4de9a07",
+		[]annotation{{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "isClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}},
+	)
+
+	tests := []struct {
+		name           string
+		body           []byte
+		headerFormat   string
+		configured     string
+		expectedMapped bool
+	}{
+		{"raw", document, "", autoEnvelope, true},
+		{"payload detected", payloadEnvelopeOf(t, document, false), "", autoEnvelope, true},
+		{"payload by header", payloadEnvelopeOf(t, document, true), payloadEnvelope, rawEnvelope, true},
+		{"raw by header", payloadEnvelopeOf(t, document, false), rawEnvelope, autoEnvelope, false},
+		{"unknown header format", document, "protobuf", autoEnvelope, false},
+	}
+
+	for _, test := range tests {
+		producer := mockMessageProducer{}
+		deadLetter := mockMessageProducer{}
+		h := newQueueHandler(serviceConfig{envelopeFormat: test.configured}, &producer, getLogger())
+		h.deadLetterProducer = &deadLetter
+
+		headers := createHeaders(nextVideoOrigin, "tid_envelope")
+		if test.headerFormat != "" {
+			headers[envelopeHeader] = test.headerFormat
+		}
+		require.NoError(t, h.queueConsume(Message{Headers: headers, Body: string(test.body)}), test.name)
+
+		assert.Equal(t, test.expectedMapped, producer.sendCalled, test.name)
+		if test.expectedMapped {
+			assert.JSONEq(t, expected, producer.message, test.name)
+			continue
+		}
+		assert.Equal(t, string(test.body), deadLetter.message, "The original message should be dead-lettered. %s", test.name)
+	}
+	assert.True(t, isEnvelopeFormat(autoEnvelope))
+	assert.False(t, isEnvelopeFormat("protobuf"))
+}
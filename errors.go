@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Stable codes of the mapping errors. They are used as log fields, metric labels,
+// dead-letter metadata and in the /map error responses, so they must not be renamed.
+const (
+	codeInvalidJSON        = "invalid_json"
+	codeInvalidEnvelope    = "invalid_envelope"
+	codeMissingField       = "missing_field"
+	codeWrongFieldType     = "wrong_field_type"
+	codeMissingTID         = "missing_transaction_id"
+	codeSchemaViolation    = "schema_violation"
+	codeUnknownPredicate   = "unknown_predicate"
+	codeInvalidConceptType = "invalid_concept_type"
+	codeInvalidAnnotations = "invalid_annotations"
+	codeRuleViolation      = "rule_violation"
+	codeUnknownConcept     = "unknown_concept"
+	codeInvalidOutput      = "invalid_output"
+	codeFetchFailed        = "fetch_failed"
+	codeProduceFailed      = "produce_failed"
+	codePoisonMessage      = "poison_message"
+	codeInternal           = "internal_error"
+)
+
+// Severities of the mapping errors:
+// a warning does not prevent the video from being mapped, an error rejects the message
+// and a critical error is a failure of the service rather than of the message.
+const (
+	severityWarning  = "warning"
+	severityError    = "error"
+	severityCritical = "critical"
+)
+
+type errorCodeInfo struct {
+	severity   string
+	httpStatus int
+}
+
+var errorCodes = map[string]errorCodeInfo{
+	codeInvalidJSON:        {severityError, http.StatusBadRequest},
+	codeInvalidEnvelope:    {severityError, http.StatusBadRequest},
+	codeMissingField:       {severityError, http.StatusBadRequest},
+	codeWrongFieldType:     {severityError, http.StatusBadRequest},
+	codeMissingTID:         {severityError, http.StatusBadRequest},
+	codeSchemaViolation:    {severityError, http.StatusBadRequest},
+	codeUnknownPredicate:   {severityWarning, http.StatusBadRequest},
+	codeInvalidConceptType: {severityWarning, http.StatusBadRequest},
+	codeInvalidAnnotations: {severityError, http.StatusBadRequest},
+	codeRuleViolation:      {severityError, http.StatusBadRequest},
+	codeUnknownConcept:     {severityError, http.StatusBadRequest},
+	codeInvalidOutput:      {severityCritical, http.StatusInternalServerError},
+	codeFetchFailed:        {severityCritical, http.StatusBadGateway},
+	codeProduceFailed:      {severityCritical, http.StatusServiceUnavailable},
+	codePoisonMessage:      {severityError, http.StatusInternalServerError},
+	codeInternal:           {severityCritical, http.StatusInternalServerError},
+}
+
+// mappingError is a typed failure of the mapping process.
+// Field holds the JSON pointer of the offending field of the Next video JSON, if any.
+type mappingError struct {
+	Code     string `json:"code"`
+	Severity string `json:"severity"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+	cause    error
+}
+
+func newMappingError(code, field, format string, args ...interface{}) *mappingError {
+	return &mappingError{
+		Code:     code,
+		Severity: errorCodes[code].severity,
+		Field:    field,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *mappingError) withCause(err error) *mappingError {
+	e.cause = err
+	return e
+}
+
+func (e *mappingError) Error() string {
+	return e.Message
+}
+
+func (e *mappingError) Unwrap() error {
+	return e.cause
+}
+
+func (e *mappingError) httpStatus() int {
+	if info, ok := errorCodes[e.Code]; ok {
+		return info.httpStatus
+	}
+	return http.StatusInternalServerError
+}
+
+func (e *mappingError) logFields() map[string]interface{} {
+	return map[string]interface{}{
+		"error_code":     e.Code,
+		"error_field":    e.Field,
+		"error_severity": e.Severity,
+	}
+}
+
+// toMappingError returns the mappingError within err, classifying any other error as internal.
+func toMappingError(err error) *mappingError {
+	var me *mappingError
+	if errors.As(err, &me) {
+		return me
+	}
+	return newMappingError(codeInternal, "", "%v", err).withCause(err)
+}
+
+func fieldPath(segments ...interface{}) string {
+	path := ""
+	for _, s := range segments {
+		path += fmt.Sprintf("/%v", s)
+	}
+	return path
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewMappingError(t *testing.T) {
+	tests := []struct {
+		code             string
+		expectedSeverity string
+		expectedStatus   int
+	}{
+		{codeInvalidJSON, severityError, http.StatusBadRequest},
+		{codeInvalidEnvelope, severityError, http.StatusBadRequest},
+		{codeMissingField, severityError, http.StatusBadRequest},
+		{codeUnknownPredicate, severityWarning, http.StatusBadRequest},
+		{codeInvalidOutput, severityCritical, http.StatusInternalServerError},
+		{codeFetchFailed, severityCritical, http.StatusBadGateway},
+		{codeProduceFailed, severityCritical, http.StatusServiceUnavailable},
+		{codePoisonMessage, severityError, http.StatusInternalServerError},
+		{"unknown_code", "", http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		me := newMappingError(test.code, "/id", "field %s is wrong", "id")
+		assert.Equal(t, test.expectedSeverity, me.Severity, "Severity is wrong. Code: %s", test.code)
+		assert.Equal(t, test.expectedStatus, me.httpStatus(), "HTTP status is wrong. Code: %s", test.code)
+		assert.Equal(t, "field id is wrong", me.Error())
+	}
+}
+
+func TestToMappingError(t *testing.T) {
+	me := newMappingError(codeMissingField, "/id", "missing")
+	assert.Same(t, me, toMappingError(fmt.Errorf("wrapped: %w", me)))
+
+	cause := errors.New("boom")
+	internal := toMappingError(cause)
+	assert.Equal(t, codeInternal, internal.Code)
+	assert.Equal(t, severityCritical, internal.Severity)
+	assert.True(t, errors.Is(internal, cause), "The original error should be kept as the cause")
+}
+
+func TestMappingErrorJSON(t *testing.T) {
+	data, err := json.Marshal(newMappingError(codeWrongFieldType, fieldPath("annotations", 2, "id"), "wrong type"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"code":"wrong_field_type","severity":"error","field":"/annotations/2/id","message":"wrong type"}`, string(data))
+
+	data, err = json.Marshal(newMappingError(codeInvalidJSON, "", "not json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"code":"invalid_json","severity":"error","message":"not json"}`, string(data))
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+const explainParam = "explain"
+
+// mappingExplanation is the /map?explain=true response: the mapped ConceptAnnotation,
+// together with how its annotations were retrieved and checked.
+type mappingExplanation struct {
+	ConceptAnnotation json.RawMessage `json:"conceptAnnotation"`
+	Quality           *qualityReport  `json:"quality,omitempty"`
+	TypeViolations    []typeViolation `json:"typeViolations,omitempty"`
+	RuleViolations    []ruleViolation `json:"ruleViolations,omitempty"`
+}
+
+func (vm *videoMapper) explain(mapped []byte) ([]byte, error) {
+	return json.Marshal(mappingExplanation{
+		ConceptAnnotation: mapped,
+		Quality:           vm.quality,
+		TypeViolations:    vm.typeViolations,
+		RuleViolations:    vm.ruleViolations,
+	})
+}
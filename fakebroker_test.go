@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	errFakeBrokerUnreachable = errors.New("fake broker is unreachable")
+	errFakeConsumerLagging   = errors.New("fake consumer is lagging")
+)
+
+// fakeBroker is an in-memory stand-in for Kafka.
+// Its consumers and producers implement the Source and Sink interfaces used by the service.
+type fakeBroker struct {
+	mu          sync.Mutex
+	topics      map[string][]Message
+	subscribers map[string][]chan Message
+	unreachable bool
+	lagging     bool
+}
+
+func newFakeBroker() *fakeBroker {
+	return &fakeBroker{
+		topics:      make(map[string][]Message),
+		subscribers: make(map[string][]chan Message),
+	}
+}
+
+// publish appends the message to the topic and delivers it to the topic consumers.
+func (b *fakeBroker) publish(topic string, m Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.topics[topic] = append(b.topics[topic], m)
+	for _, ch := range b.subscribers[topic] {
+		ch <- m
+	}
+}
+
+// messages returns a snapshot of the messages published to the topic.
+func (b *fakeBroker) messages(topic string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]Message(nil), b.topics[topic]...)
+}
+
+// waitForMessages waits until the topic holds at least n messages and returns them.
+func (b *fakeBroker) waitForMessages(t *testing.T, topic string, n int) []Message {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if msgs := b.messages(topic); len(msgs) >= n {
+			return msgs
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d messages on topic %s, got %d", n, topic, len(b.messages(topic)))
+	return nil
+}
+
+func (b *fakeBroker) setUnreachable(unreachable bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unreachable = unreachable
+}
+
+func (b *fakeBroker) setLagging(lagging bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lagging = lagging
+}
+
+func (b *fakeBroker) connectivityCheck() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.unreachable {
+		return errFakeBrokerUnreachable
+	}
+	return nil
+}
+
+// subscribe returns a channel replaying the topic from the beginning and receiving every later message.
+func (b *fakeBroker) subscribe(topic string) chan Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan Message, 1000)
+	for _, m := range b.topics[topic] {
+		ch <- m
+	}
+	b.subscribers[topic] = append(b.subscribers[topic], ch)
+	return ch
+}
+
+func (b *fakeBroker) consumer(topic string) *fakeConsumer {
+	return &fakeConsumer{broker: b, topic: topic, closed: make(chan struct{})}
+}
+
+func (b *fakeBroker) producer(topic string) *fakeProducer {
+	return &fakeProducer{broker: b, topic: topic}
+}
+
+type fakeConsumer struct {
+	broker    *fakeBroker
+	topic     string
+	closeOnce sync.Once
+	closed    chan struct{}
+
+	mu        sync.Mutex
+	committed int
+}
+
+// Start delivers the messages one at a time like kafkaSource does, committing the offset of a message
+// only once it and the messages before it are settled.
+func (c *fakeConsumer) Start(handler func(Message) error) {
+	msgs := c.broker.subscribe(c.topic)
+	r := redelivery{initialBackoff: 10 * time.Millisecond, maxBackoff: 50 * time.Millisecond, log: getLogger()}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.closed
+		cancel()
+	}()
+	offsets := newOffsetTracker()
+	for offset := int64(0); ; offset++ {
+		select {
+		case <-c.closed:
+			return
+		case m := <-msgs:
+			settled := true
+			m.settle = func(result <-chan error) {
+				settled = false
+				offsets.settleLater(ctx, offset, result, c.commit)
+			}
+			offsets.add(offset)
+			if err := r.deliver(ctx, handler, m); errors.Is(err, context.Canceled) {
+				return
+			}
+			if settled {
+				offsets.settle(offset, c.commit)
+			}
+		}
+	}
+}
+
+func (c *fakeConsumer) commit(next int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.committed = int(next)
+}
+
+// committedOffset returns the number of messages of the topic committed by the consumer.
+func (c *fakeConsumer) committedOffset() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.committed
+}
+
+func (c *fakeConsumer) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *fakeConsumer) ConnectivityCheck() error {
+	return c.broker.connectivityCheck()
+}
+
+func (c *fakeConsumer) MonitorCheck() error {
+	if err := c.broker.connectivityCheck(); err != nil {
+		return err
+	}
+	c.broker.mu.Lock()
+	defer c.broker.mu.Unlock()
+	if c.broker.lagging {
+		return errFakeConsumerLagging
+	}
+	return nil
+}
+
+type fakeProducer struct {
+	broker *fakeBroker
+	topic  string
+}
+
+func (p *fakeProducer) SendMessage(m Message) error {
+	if err := p.broker.connectivityCheck(); err != nil {
+		return err
+	}
+	p.broker.publish(p.topic, m)
+	return nil
+}
+
+func (p *fakeProducer) Close() error {
+	return nil
+}
+
+func (p *fakeProducer) ConnectivityCheck() error {
+	return p.broker.connectivityCheck()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	contentURIField        = "contentUri"
+	initialFetchRetryDelay = 200 * time.Millisecond
+)
+
+// Results of the fetches of the full video documents.
+const (
+	fetchFetched  = "fetched"
+	fetchNotFound = "not_found"
+	fetchFailed   = "failed"
+	fetchRetried  = "retried"
+)
+
+// videoFetcher fetches the full Next video document of a video.
+type videoFetcher interface {
+	fetch(ctx context.Context, videoUUID string) (map[string]interface{}, error)
+}
+
+// errVideoNotFound is returned for the videos unknown to the Next video API, which are not worth fetching again.
+var errVideoNotFound = errors.New("was not found")
+
+// httpVideoFetcher fetches the documents from an HTTP Next video API responding to GET <url>/<uuid> with the document.
+// Failed requests, other than for unknown videos, are retried with an exponential backoff.
+type httpVideoFetcher struct {
+	url        string
+	client     *http.Client
+	retries    int
+	retryDelay time.Duration
+}
+
+func newHTTPVideoFetcher(url string, timeout time.Duration, retries int) *httpVideoFetcher {
+	return &httpVideoFetcher{
+		url:        strings.TrimSuffix(url, "/"),
+		client:     &http.Client{Timeout: timeout},
+		retries:    retries,
+		retryDelay: initialFetchRetryDelay,
+	}
+}
+
+func (f *httpVideoFetcher) fetch(ctx context.Context, videoUUID string) (map[string]interface{}, error) {
+	delay := f.retryDelay
+	for attempt := 0; ; attempt++ {
+		document, err := f.get(ctx, videoUUID)
+		switch {
+		case err == nil:
+			videoFetches.WithLabelValues(fetchFetched).Inc()
+			return document, nil
+		case errors.Is(err, errVideoNotFound):
+			videoFetches.WithLabelValues(fetchNotFound).Inc()
+			return nil, err
+		case attempt >= f.retries:
+			videoFetches.WithLabelValues(fetchFailed).Inc()
+			return nil, err
+		}
+
+		videoFetches.WithLabelValues(fetchRetried).Inc()
+		select {
+		case <-ctx.Done():
+			videoFetches.WithLabelValues(fetchFailed).Inc()
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (f *httpVideoFetcher) get(ctx context.Context, videoUUID string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.url+"/"+videoUUID, nil)
+	if err != nil {
+		return nil, err
+	}
+	injectHTTPTraceContext(ctx, req.Header)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("video %s %w", videoUUID, errVideoNotFound)
+	default:
+		return nil, fmt.Errorf("Next video API responded with status %d for video %s", resp.StatusCode, videoUUID)
+	}
+
+	var document map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		return nil, fmt.Errorf("Next video API response for video %s couldn't be decoded: %w", videoUUID, err)
+	}
+	return document, nil
+}
+
+// needsFetching tells whether the event only references the video, without carrying its annotations.
+func (vm *videoMapper) needsFetching() bool {
+	if vm.isDeleteEvent() {
+		return false
+	}
+	_, hasAnnotations := vm.unmarshalled[annotationsField]
+	return !hasAnnotations
+}
+
+// referencedVideoUUID returns the UUID of the video referenced by the event: its id or uuid field,
+// or else the last segment of its content URI.
+func (vm *videoMapper) referencedVideoUUID() string {
+	for _, field := range []string{videoIDField, videoUUIDField} {
+		if id, ok := vm.unmarshalled[field].(string); ok && id != "" {
+			return id
+		}
+	}
+	if contentURI, ok := vm.unmarshalled[contentURIField].(string); ok {
+		return contentURI[strings.LastIndex(contentURI, "/")+1:]
+	}
+	return ""
+}
+
+// fetchFullDocument replaces an event which only references the video with the full document fetched
+// from the Next video API, if one is configured.
+func (vm *videoMapper) fetchFullDocument(ctx context.Context) error {
+	if vm.sc.videoFetcher == nil || !vm.needsFetching() {
+		return nil
+	}
+	ctx, span := startSpan(ctx, "fetchFullDocument")
+	defer span.End()
+
+	parsed, err := uuid.Parse(vm.referencedVideoUUID())
+	if err != nil {
+		me := newMappingError(codeMissingField, fieldPath(videoIDField), "event carries neither annotations nor the UUID of the video to fetch")
+		recordSpanError(span, me)
+		return me
+	}
+	videoUUID := parsed.String()
+	document, err := vm.sc.videoFetcher.fetch(ctx, videoUUID)
+	if err != nil {
+		me := newMappingError(codeFetchFailed, "", "fetching the full document of video %s failed: %v", videoUUID, err).withCause(err)
+		recordSpanError(span, me)
+		return me
+	}
+	vm.log.WithTransactionID(vm.tid).
+		WithUUID(videoUUID).
+		Info("Fetched the full document of the video referenced by the event")
+	vm.unmarshalled = document
+	return nil
+}
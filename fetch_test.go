@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fetchedVideoUUID = "e2290d14-7e80-4db8-a715-949da4de9a07"
+
+// nextVideoAPIStub stands in for the Next video API, knowing only fetchedVideoUUID.
+// It fails the first failures requests with failureStatus.
+type nextVideoAPIStub struct {
+	document []byte
+
+	mu            sync.Mutex
+	requests      int
+	failures      int
+	failureStatus int
+	delay         time.Duration
+}
+
+func (s *nextVideoAPIStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	failing := s.requests <= s.failures
+	delay := s.delay
+	s.mu.Unlock()
+
+	time.Sleep(delay)
+	if failing {
+		w.WriteHeader(s.failureStatus)
+		return
+	}
+	if strings.TrimPrefix(r.URL.Path, "/video/") != fetchedVideoUUID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write(s.document)
+}
+
+func (s *nextVideoAPIStub) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestHTTPVideoFetcher(t *testing.T) {
+	stub := &nextVideoAPIStub{document: getBytes("next-video-input.json", t)}
+	fetcher := newHTTPVideoFetcher(startStubServer(stub, t)+"/video/", 100*time.Millisecond, 2)
+
+	document, err := fetcher.fetch(context.Background(), fetchedVideoUUID)
+	require.NoError(t, err)
+	assert.Equal(t, fetchedVideoUUID, document["id"])
+	assert.Equal(t, 1, stub.requestCount())
+}
+
+func TestHTTPVideoFetcherRetries(t *testing.T) {
+	tests := []struct {
+		failures    int
+		expectedErr string
+	}{
+		{2, ""},
+		{3, "Next video API responded with status 503 for video " + fetchedVideoUUID},
+	}
+
+	for _, test := range tests {
+		stub := &nextVideoAPIStub{document: getBytes("next-video-input.json", t), failures: test.failures, failureStatus: http.StatusServiceUnavailable}
+		fetcher := newHTTPVideoFetcher(startStubServer(stub, t)+"/video/", 100*time.Millisecond, 2)
+		fetcher.retryDelay = time.Millisecond
+
+		_, err := fetcher.fetch(context.Background(), fetchedVideoUUID)
+		if test.expectedErr == "" {
+			assert.NoError(t, err, "The video should be fetched once the API recovers within the retries")
+		} else {
+			assert.EqualError(t, err, test.expectedErr)
+		}
+		assert.Equal(t, 3, stub.requestCount(), "The request should not be retried more than configured. Failures: %d", test.failures)
+	}
+}
+
+func TestHTTPVideoFetcherNotFound(t *testing.T) {
+	stub := &nextVideoAPIStub{document: getBytes("next-video-input.json", t)}
+	fetcher := newHTTPVideoFetcher(startStubServer(stub, t)+"/video/", 100*time.Millisecond, 2)
+
+	_, err := fetcher.fetch(context.Background(), "c4cde316-128c-11e7-80f4-13e067d5072c")
+	assert.True(t, errors.Is(err, errVideoNotFound))
+	assert.EqualError(t, err, "video c4cde316-128c-11e7-80f4-13e067d5072c was not found")
+	assert.Equal(t, 1, stub.requestCount(), "Unknown videos should not be fetched again")
+}
+
+func TestHTTPVideoFetcherTimeout(t *testing.T) {
+	stub := &nextVideoAPIStub{document: getBytes("next-video-input.json", t), delay: 200 * time.Millisecond}
+	fetcher := newHTTPVideoFetcher(startStubServer(stub, t)+"/video/", 100*time.Millisecond, 1)
+	fetcher.retryDelay = time.Millisecond
+
+	_, err := fetcher.fetch(context.Background(), fetchedVideoUUID)
+	assert.Error(t, err)
+	assert.Equal(t, 2, stub.requestCount(), "A timed out request should be retried")
+}
+
+func TestMapNextVideoAnnotationsFetchesReferencedVideo(t *testing.T) {
+	expected := newStringConceptAnnotation(t, fetchedVideoUUID,
+		[]annotation{{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "isClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}},
+	)
+
+	tests := []struct {
+		name             string
+		event            string
+		expectedContent  string
+		expectedCode     string
+		expectedRequests int
+	}{
+		{"reference by id", `{"id": "` + fetchedVideoUUID + `", "contentUri": "http://next-video-api/video/` + fetchedVideoUUID + `"}`, expected, "", 1},
+		{"reference by content URI", `{"contentUri": "http://next-video-api/video/` + fetchedVideoUUID + `"}`, expected, "", 1},
+		{"unknown video", `{"id": "c4cde316-128c-11e7-80f4-13e067d5072c"}`, "", codeFetchFailed, 1},
+		{"no video UUID", `{"contentUri": "http://next-video-api/video/"}`, "", codeMissingField, 0},
+		{"annotations carried", `{"id": "` + fetchedVideoUUID + `", "annotations": []}`, newStringConceptAnnotation(t, fetchedVideoUUID, nil), "", 0},
+		{"delete event", `{"uuid": "` + fetchedVideoUUID + `", "deleted": true}`, newStringConceptAnnotation(t, fetchedVideoUUID, nil), "", 0},
+	}
+
+	for _, test := range tests {
+		stub := &nextVideoAPIStub{document: getBytes("next-video-input.json", t)}
+		fetcher := newHTTPVideoFetcher(startStubServer(stub, t)+"/video/", 100*time.Millisecond, 0)
+		vm := videoMapper{
+			sc:         serviceConfig{videoFetcher: fetcher, emptyAnnotationsPolicy: publishEmptyAnnotations},
+			strContent: test.event,
+			log:        getLogger(),
+		}
+		require.NoError(t, vm.unmarshal(context.Background()), test.name)
+
+		content, _, err := vm.mapNextVideoAnnotations(context.Background())
+		assert.Equal(t, test.expectedRequests, stub.requestCount(), "Requests are wrong. %s", test.name)
+		if test.expectedCode != "" {
+			require.Error(t, err, test.name)
+			assert.Equal(t, test.expectedCode, toMappingError(err).Code, test.name)
+			continue
+		}
+		require.NoError(t, err, test.name)
+		assert.JSONEq(t, test.expectedContent, string(content), test.name)
+	}
+}
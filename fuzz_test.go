@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+// Run the fuzz targets with e.g. `go test -fuzz FuzzMapNextVideoAnnotationsRequest -fuzztime 1m .`
+
+func getQuietLogger() *logger.UPPLogger {
+	return logger.NewUPPLogger("video-annotations-mapper", "fatal")
+}
+
+func addSeedCorpus(f *testing.F) {
+	for _, pattern := range []string{"test-resources/*.json", filepath.Join(goldenDir, "*"+goldenInputSuffix)} {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				f.Fatal(err)
+			}
+			f.Add(data)
+		}
+	}
+}
+
+func FuzzMapNextVideoAnnotationsRequest(f *testing.F) {
+	addSeedCorpus(f)
+	f.Add([]byte(`{"contentUri":"x","payload":{"id":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[]}}`))
+	h := newServiceHandler(serviceConfig{}, getQuietLogger())
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		vm := videoMapper{strContent: string(input), tid: "tid_fuzz", log: h.log}
+		output, videoUUID, err := h.mapNextVideoAnnotationsRequest(context.Background(), &vm)
+		if err != nil {
+			if output != nil {
+				t.Errorf("Output %s returned together with error %v", output, err)
+			}
+			return
+		}
+
+		var concept ConceptAnnotation
+		if err := json.Unmarshal(output, &concept); err != nil {
+			t.Fatalf("Output is not a valid ConceptAnnotation: %v. Output: %s", err, output)
+		}
+
+		document, format, err := unwrapEnvelope(input, "")
+		if err != nil {
+			t.Fatalf("Mapping succeeded for an input whose %s envelope can't be unwrapped: %v", format, err)
+		}
+		var payload map[string]interface{}
+		if err := json.Unmarshal(document, &payload); err != nil {
+			t.Fatalf("Mapping succeeded for invalid JSON input: %v", err)
+		}
+		uuidField := videoIDField
+		if _, deleted := payload[deletedField]; deleted {
+			uuidField = videoUUIDField
+		}
+		expectedUUID, ok := payload[uuidField].(string)
+		if !ok {
+			t.Fatalf("Mapping succeeded without a string %s field", uuidField)
+		}
+		if concept.UUID != expectedUUID || videoUUID != expectedUUID {
+			t.Errorf("Output UUID %q and returned UUID %q differ from input %s %q", concept.UUID, videoUUID, uuidField, expectedUUID)
+		}
+		if concept.Annotations == nil {
+			t.Errorf("Output annotations should be an empty array rather than null")
+		}
+	})
+}
+
+func FuzzRetrieveAnnotations(f *testing.F) {
+	addSeedCorpus(f)
+	f.Add([]byte(`[{"id":"http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740","predicate":"http://www.ft.com/ontology/annotation/about"},{"id":1,"predicate":null},{}]`))
+	vm := videoMapper{tid: "tid_fuzz", log: getQuietLogger()}
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		var nextAnns []map[string]interface{}
+		if err := json.Unmarshal(input, &nextAnns); err != nil {
+			var payload map[string]interface{}
+			if err := json.Unmarshal(input, &payload); err != nil {
+				return
+			}
+			if nextAnns, err = getObjectsArrayField(annotationsField, payload, "", &vm); err != nil {
+				return
+			}
+		}
+
+		tags := vm.retrieveAnnotations(nextAnns, "")
+		if len(tags) > len(nextAnns) {
+			t.Fatalf("Retrieved %d annotations out of %d", len(tags), len(nextAnns))
+		}
+		for _, tag := range tags {
+			if _, known := shortPredicates[tag.predicate]; !known {
+				t.Errorf("Retrieved annotation with unknown predicate %q", tag.predicate)
+			}
+		}
+	})
+}
+
+func FuzzBylineNames(f *testing.F) {
+	for _, byline := range []string{
+		"Filmed by Niclola Stansfield. Produced by Seb Morton-Clark.",
+		"Produced by Seb Morton-Clark and Niclola Stansfield; edited by John F. Smith, Ana Ray & Alexandra Andrews",
+		"ȺȺȺȺȺȺȺȺ by x",
+		"İİİİİİ by x",
+		"by",
+		"",
+	} {
+		f.Add(byline)
+	}
+
+	f.Fuzz(func(t *testing.T, byline string) {
+		for _, name := range bylineNames(byline) {
+			if name == "" || name != strings.TrimSpace(name) {
+				t.Errorf("Byline %q gives the untrimmed name %q", byline, name)
+			}
+			if !strings.Contains(byline, name) {
+				t.Errorf("Byline %q gives the name %q, which it does not contain", byline, name)
+			}
+		}
+	})
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The golden files live in test-resources/golden. Every <name>.input.json is a Next video payload, accompanied by:
+//   - <name>.expected.json: the mapped ConceptAnnotation, when the payload can be mapped;
+//   - <name>.error.json: the expected error, when the payload is rejected;
+//   - <name>.headers.json: optionally, the headers of the message written to the queue.
+//
+// Run `go test -run TestGoldenFiles -update` to regenerate the expected files from the current mapper output.
+var updateGolden = flag.Bool("update", false, "Regenerate the expected golden files in test-resources/golden")
+
+const (
+	goldenDir         = "test-resources/golden"
+	goldenInputSuffix = ".input.json"
+	goldenTID         = "tid_golden"
+)
+
+// volatileHeaders differ on every mapped message, so they are not compared against the golden files.
+var volatileHeaders = []string{"Message-Id", "Message-Timestamp"}
+
+type goldenError struct {
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+}
+
+type goldenResult struct {
+	body    []byte
+	headers map[string]string
+	err     *goldenError
+}
+
+func TestGoldenFiles(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join(goldenDir, "*"+goldenInputSuffix))
+	require.NoError(t, err)
+	require.NotEmpty(t, inputs, "No golden input files found in %s", goldenDir)
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), goldenInputSuffix)
+		t.Run(name, func(t *testing.T) {
+			body, err := os.ReadFile(input)
+			require.NoError(t, err)
+
+			actual := mapGoldenInput(t, body)
+			if *updateGolden {
+				writeGoldenFiles(t, name, actual)
+			}
+			assertGoldenFiles(t, name, actual)
+		})
+	}
+}
+
+// mapGoldenInput runs the input through both the queue and the HTTP mapping paths and checks they agree.
+func mapGoldenInput(t *testing.T, input []byte) goldenResult {
+	producer := &mockMessageProducer{}
+	qh := newQueueHandler(serviceConfig{}, producer, getLogger())
+	qh.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, goldenTID), Body: string(input)})
+
+	sh := newServiceHandler(serviceConfig{}, getLogger())
+	req := httptest.NewRequest(http.MethodPost, "/map", bytes.NewReader(input))
+	req.Header.Set("X-Request-Id", goldenTID)
+	w := httptest.NewRecorder()
+	sh.mapRequest(w, req)
+
+	if w.Code != http.StatusOK {
+		assert.False(t, producer.sendCalled, "A message rejected by /map should not be sent to the queue")
+		var me mappingError
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &me), "/map should respond with a mapping error")
+		return goldenResult{err: &goldenError{Status: w.Code, Code: me.Code}}
+	}
+
+	require.True(t, producer.sendCalled, "A message mapped by /map should also be sent to the queue")
+	assert.JSONEq(t, w.Body.String(), producer.message, "The queue and /map outputs differ")
+
+	headers := make(map[string]string)
+	for k, v := range producer.headers {
+		headers[k] = v
+	}
+	for _, h := range volatileHeaders {
+		assert.NotEmpty(t, headers[h], "Header %s should be set", h)
+		delete(headers, h)
+	}
+	return goldenResult{body: []byte(producer.message), headers: headers}
+}
+
+func assertGoldenFiles(t *testing.T, name string, actual goldenResult) {
+	expectedBody, bodyFound := readGoldenFile(t, name+".expected.json")
+	expectedErr, errFound := readGoldenFile(t, name+".error.json")
+
+	if actual.err != nil {
+		require.True(t, errFound, "Input was rejected with status %d but %s.error.json is missing", actual.err.Status, name)
+		var ge goldenError
+		require.NoError(t, json.Unmarshal(expectedErr, &ge))
+		assert.Equal(t, ge, *actual.err, "Error is wrong")
+		assert.False(t, bodyFound, "Input was rejected but %s.expected.json exists", name)
+		return
+	}
+
+	require.True(t, bodyFound, "Input was mapped but %s.expected.json is missing", name)
+	assert.JSONEq(t, string(expectedBody), string(actual.body), "Mapped content is wrong")
+	assert.False(t, errFound, "Input was mapped but %s.error.json exists", name)
+
+	if expectedHeaders, found := readGoldenFile(t, name+".headers.json"); found {
+		var headers map[string]string
+		require.NoError(t, json.Unmarshal(expectedHeaders, &headers))
+		assert.Equal(t, headers, actual.headers, "Message headers are wrong")
+	}
+}
+
+func writeGoldenFiles(t *testing.T, name string, actual goldenResult) {
+	if actual.err != nil {
+		writeGoldenJSON(t, name+".error.json", actual.err)
+		removeGoldenFile(t, name+".expected.json")
+		removeGoldenFile(t, name+".headers.json")
+		return
+	}
+
+	writeGoldenJSON(t, name+".expected.json", json.RawMessage(actual.body))
+	removeGoldenFile(t, name+".error.json")
+	if _, found := readGoldenFile(t, name+".headers.json"); found {
+		writeGoldenJSON(t, name+".headers.json", actual.headers)
+	}
+}
+
+func readGoldenFile(t *testing.T, fileName string) ([]byte, bool) {
+	data, err := os.ReadFile(filepath.Join(goldenDir, fileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false
+	}
+	require.NoError(t, err)
+	return data, true
+}
+
+func writeGoldenJSON(t *testing.T, fileName string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(goldenDir, fileName), append(data, '\n'), 0644))
+}
+
+func removeGoldenFile(t *testing.T, fileName string) {
+	err := os.Remove(filepath.Join(goldenDir, fileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		require.NoError(t, err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
@@ -22,9 +23,15 @@ type messageConsumerHealthcheck interface {
 	MonitorCheck() error
 }
 
+// consumptionStateCheck reports the state of the circuit breaker pausing the consumption.
+type consumptionStateCheck interface {
+	state() string
+}
+
 type HealthCheck struct {
 	consumer      messageConsumerHealthcheck
 	producer      messageProducerHealthcheck
+	consumption   consumptionStateCheck
 	appName       string
 	appSystemCode string
 	panicGuide    string
@@ -42,6 +49,9 @@ func NewHealthCheck(p messageProducerHealthcheck, c messageConsumerHealthcheck,
 
 func (h *HealthCheck) Health() func(w http.ResponseWriter, r *http.Request) {
 	checks := []fthealth.Check{h.readQueueCheck(), h.readQueueLagCheck(), h.writeQueueCheck()}
+	if h.consumption != nil {
+		checks = append(checks, h.consumptionCheck())
+	}
 
 	hc := fthealth.TimedHealthCheck{
 		HealthCheck: fthealth.HealthCheck{
@@ -92,6 +102,18 @@ func (h *HealthCheck) writeQueueCheck() fthealth.Check {
 	}
 }
 
+func (h *HealthCheck) consumptionCheck() fthealth.Check {
+	return fthealth.Check{
+		ID:               "message-consumption-not-paused",
+		Name:             "Message Consumption Is Not Paused",
+		Severity:         2,
+		BusinessImpact:   "Annotations from published Next videos will be created with latency, once the write message queue is available again.",
+		TechnicalSummary: "Consumption of the read message queue is paused because the messages could not be written to the write message queue. It resumes automatically once the write message queue is available.",
+		PanicGuide:       h.panicGuide,
+		Checker:          h.checkIfConsumptionIsNotPaused,
+	}
+}
+
 func (h *HealthCheck) GTG() gtg.Status {
 	consumerCheck := func() gtg.Status {
 		return gtgCheck(h.checkIfKafkaIsReachableFromConsumer)
@@ -136,3 +158,10 @@ func (h *HealthCheck) checkIfKafkaIsReachableFromProducer() (string, error) {
 	}
 	return ResponseOK, nil
 }
+
+func (h *HealthCheck) checkIfConsumptionIsNotPaused() (string, error) {
+	if state := h.consumption.state(); state != breakerClosed {
+		return "", fmt.Errorf("consumption is paused, circuit breaker is %s", state)
+	}
+	return ResponseOK, nil
+}
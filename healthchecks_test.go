@@ -124,3 +124,28 @@ func (c *mockConsumerInstance) MonitorCheck() error {
 	}
 	return errors.New("error kafka client is lagging ")
 }
+
+type mockConsumptionState struct {
+	current string
+}
+
+func (c *mockConsumptionState) state() string {
+	return c.current
+}
+
+func TestHealthCheckWithPausedConsumption(t *testing.T) {
+	hc := initializeHealthCheck(true, true)
+	consumption := &mockConsumptionState{current: breakerClosed}
+	hc.consumption = consumption
+
+	req := httptest.NewRequest("GET", "http://example.com/__health", nil)
+	w := httptest.NewRecorder()
+	hc.Health()(w, req)
+	assert.Contains(t, w.Body.String(), `"name":"Message Consumption Is Not Paused","ok":true`, "Consumption check should be happy")
+
+	consumption.current = breakerOpen
+	w = httptest.NewRecorder()
+	hc.Health()(w, req)
+	assert.Contains(t, w.Body.String(), `"name":"Message Consumption Is Not Paused","ok":false`, "Consumption check should be unhappy")
+	assert.Contains(t, w.Body.String(), "circuit breaker is open")
+}
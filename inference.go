@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// defaultDerivedScore is the relevance and confidence score of the derived annotations,
+// lower than the default scores of the explicit ones.
+const defaultDerivedScore = 0.5
+
+// inferenceRule derives an annotation with the Derive predicate from each explicit annotation with the From predicate,
+// e.g. about X implies mentions X. The derived annotations are scored lower than the explicit ones.
+type inferenceRule struct {
+	From            string  `json:"from"`
+	Derive          string  `json:"derive"`
+	RelevanceScore  float64 `json:"relevanceScore,omitempty"`
+	ConfidenceScore float64 `json:"confidenceScore,omitempty"`
+}
+
+// loadInferenceRules reads the inference rules from a JSON file. An empty path means no inference.
+func loadInferenceRules(path string) ([]inferenceRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []inferenceRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("inference rules in %s are not valid JSON: %w", path, err)
+	}
+	for i, rule := range rules {
+		for _, predicate := range []string{rule.From, rule.Derive} {
+			if _, known := shortPredicates[predicate]; !known {
+				return nil, fmt.Errorf("inference rule %d in %s uses unknown predicate %q", i, path, predicate)
+			}
+		}
+		if rule.From == rule.Derive {
+			return nil, fmt.Errorf("inference rule %d in %s derives %s from itself", i, path, rule.From)
+		}
+		for _, score := range []float64{rule.RelevanceScore, rule.ConfidenceScore} {
+			if score < 0 || score > 1 {
+				return nil, fmt.Errorf("inference rule %d in %s has score %v, expected between 0 and 1", i, path, score)
+			}
+		}
+		if rules[i].RelevanceScore == 0 {
+			rules[i].RelevanceScore = defaultDerivedScore
+		}
+		if rules[i].ConfidenceScore == 0 {
+			rules[i].ConfidenceScore = defaultDerivedScore
+		}
+	}
+	return rules, nil
+}
+
+// inferAnnotations appends the annotations derived by the rules from the explicit annotations.
+// Derived annotations are only added when no annotation with the same concept and predicate exists already,
+// and are not used to derive further annotations.
+func inferAnnotations(explicit []annotation, rules []inferenceRule) []annotation {
+	if len(rules) == 0 {
+		return explicit
+	}
+
+	type key struct{ id, predicate string }
+	existing := make(map[key]bool, len(explicit))
+	for _, ann := range explicit {
+		existing[key{ann.ID, ann.Predicate}] = true
+	}
+
+	result := explicit
+	for _, ann := range explicit {
+		for _, rule := range rules {
+			if ann.Predicate != rule.From || existing[key{ann.ID, rule.Derive}] {
+				continue
+			}
+			existing[key{ann.ID, rule.Derive}] = true
+			derivedAnnotations.WithLabelValues(rule.Derive).Inc()
+			result = append(result, annotation{
+				ID:              ann.ID,
+				Predicate:       rule.Derive,
+				RelevanceScore:  rule.RelevanceScore,
+				ConfidenceScore: rule.ConfidenceScore,
+			})
+		}
+	}
+	return result
+}
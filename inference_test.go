@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadInferenceRules(t *testing.T) {
+	rules, err := loadInferenceRules("test-resources/inference-rules.json")
+	require.NoError(t, err)
+	assert.Equal(t, []inferenceRule{
+		{From: "about", Derive: "mentions", RelevanceScore: defaultDerivedScore, ConfidenceScore: defaultDerivedScore},
+		{From: "isPrimarilyClassifiedBy", Derive: "isClassifiedBy", RelevanceScore: 0.8, ConfidenceScore: 0.8},
+	}, rules)
+
+	rules, err = loadInferenceRules("")
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+
+	for _, invalid := range []string{
+		`not json`,
+		`[{"from":"about","derive":"unknownPredicate"}]`,
+		`[{"from":"about","derive":"about"}]`,
+		`[{"from":"about","derive":"mentions","confidenceScore":1.5}]`,
+	} {
+		path := filepath.Join(t.TempDir(), "inference-rules.json")
+		require.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := loadInferenceRules(path)
+		assert.Error(t, err, "Inference rules should be rejected: %s", invalid)
+	}
+}
+
+func TestInferAnnotations(t *testing.T) {
+	rules, err := loadInferenceRules("test-resources/inference-rules.json")
+	require.NoError(t, err)
+
+	tests := []struct {
+		explicit []annotation
+		expected []annotation
+	}{
+		{
+			[]annotation{
+				{ID: "id1", Predicate: "about", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+				{ID: "id2", Predicate: "isPrimarilyClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+			},
+			[]annotation{
+				{ID: "id1", Predicate: "about", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+				{ID: "id2", Predicate: "isPrimarilyClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+				{ID: "id1", Predicate: "mentions", RelevanceScore: defaultDerivedScore, ConfidenceScore: defaultDerivedScore},
+				{ID: "id2", Predicate: "isClassifiedBy", RelevanceScore: 0.8, ConfidenceScore: 0.8},
+			},
+		},
+		{
+			[]annotation{
+				{ID: "id1", Predicate: "about", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+				{ID: "id1", Predicate: "mentions", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+			},
+			[]annotation{
+				{ID: "id1", Predicate: "about", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+				{ID: "id1", Predicate: "mentions", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+			},
+		},
+		{
+			[]annotation{
+				{ID: "id1", Predicate: "hasAuthor", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+			},
+			[]annotation{
+				{ID: "id1", Predicate: "hasAuthor", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore},
+			},
+		},
+		{
+			[]annotation{},
+			[]annotation{},
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, inferAnnotations(test.explicit, rules), "Derived annotations are wrong. Input: %v", test.explicit)
+	}
+}
+
+func TestMapNextVideoAnnotationsInference(t *testing.T) {
+	rules, err := loadInferenceRules("test-resources/inference-rules.json")
+	require.NoError(t, err)
+	vm := videoMapper{
+		sc: serviceConfig{inferenceRules: rules},
+		strContent: `{"id":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+			{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"http://www.ft.com/ontology/annotation/about"}]}`,
+		log: getLogger(),
+	}
+	require.NoError(t, vm.unmarshal(context.Background()))
+
+	output, _, err := vm.mapNextVideoAnnotations(context.Background())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+		{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"about","relevanceScore":0.9,"confidenceScore":0.9},
+		{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"mentions","relevanceScore":0.5,"confidenceScore":0.5}]}`, string(output))
+}
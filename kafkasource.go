@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/kafka-client-go/v3"
+	"github.com/Shopify/sarama"
+)
+
+// kafkaSource consumes a topic as a member of a Kafka consumer group, marking the offset of a message only once it is handled.
+// The messages whose result comes after the handler returned are committed out of order, once they and the messages before them are settled.
+type kafkaSource struct {
+	brokers       []string
+	group         string
+	topic         string
+	lagTolerance  int64
+	retryInterval time.Duration
+	redelivery    redelivery
+	handler       func(Message) error
+	log           *logger.UPPLogger
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started chan struct{}
+	stopped chan struct{}
+
+	mu            sync.RWMutex
+	consumerGroup sarama.ConsumerGroup
+	claims        map[int32]*claimedPartition
+}
+
+// claimedPartition tracks the lag of a partition claimed by the consumer.
+type claimedPartition struct {
+	claim sarama.ConsumerGroupClaim
+	// next is the offset of the next message to commit, -1 until a message is marked
+	next int64
+}
+
+func newKafkaSource(tc transportConfig, log *logger.UPPLogger) *kafkaSource {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &kafkaSource{
+		brokers:       strings.Split(tc.kafkaAddress, ","),
+		group:         tc.group,
+		topic:         tc.readTopic,
+		lagTolerance:  int64(tc.consumerLagTolerance),
+		retryInterval: time.Minute,
+		redelivery:    newRedelivery(tc.maxRedeliveries, log),
+		log:           log,
+		ctx:           ctx,
+		cancel:        cancel,
+		started:       make(chan struct{}),
+		stopped:       make(chan struct{}),
+		claims:        make(map[int32]*claimedPartition),
+	}
+}
+
+// Start connects to Kafka, retrying until it succeeds, and consumes the topic until the source is closed.
+func (s *kafkaSource) Start(handler func(Message) error) {
+	s.handler = handler
+	close(s.started)
+	defer close(s.stopped)
+
+	consumerGroup, err := s.connect()
+	if err != nil {
+		return
+	}
+	go func() {
+		for err := range consumerGroup.Errors() {
+			s.log.WithError(err).Error("Error consuming message")
+		}
+	}()
+
+	s.log.Info("Starting consumer...")
+	for s.ctx.Err() == nil {
+		if err := consumerGroup.Consume(s.ctx, []string{s.topic}, s); err != nil {
+			s.log.WithError(err).Error("Error occurred during consumer group lifecycle")
+		}
+	}
+}
+
+func (s *kafkaSource) connect() (sarama.ConsumerGroup, error) {
+	for s.ctx.Err() == nil {
+		consumerGroup, err := sarama.NewConsumerGroup(s.brokers, s.group, kafka.DefaultConsumerOptions())
+		if err == nil {
+			s.mu.Lock()
+			s.consumerGroup = consumerGroup
+			s.mu.Unlock()
+			return consumerGroup, nil
+		}
+
+		s.log.WithError(err).Warnf("Could not connect the consumer to Kafka, retrying in %s", s.retryInterval)
+		select {
+		case <-s.ctx.Done():
+		case <-time.After(s.retryInterval):
+		}
+	}
+	return nil, s.ctx.Err()
+}
+
+// Setup is run at the beginning of a new session, before ConsumeClaim.
+func (s *kafkaSource) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup is run at the end of a session, once all ConsumeClaim goroutines have exited.
+func (s *kafkaSource) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim delivers the messages of a claimed partition until the session ends, on shutdown or on a rebalance.
+// A message still not settled then is left unmarked, for it to be consumed again by the next owner of the partition.
+func (s *kafkaSource) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	s.claim(claim)
+	defer s.release(claim)
+
+	offsets := newOffsetTracker()
+	commit := func(next int64) {
+		session.MarkOffset(claim.Topic(), claim.Partition(), next, "")
+		s.marked(claim, next)
+	}
+	for {
+		select {
+		case <-session.Context().Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			m := decodeFTMessage(msg.Value)
+			settled := true
+			m.settle = func(result <-chan error) {
+				settled = false
+				offsets.settleLater(session.Context(), msg.Offset, result, commit)
+			}
+			offsets.add(msg.Offset)
+			err := s.redelivery.deliver(session.Context(), s.handler, m)
+			if err != nil && !errors.Is(err, errRedeliveriesExhausted) {
+				return nil
+			}
+			if settled {
+				offsets.settle(msg.Offset, commit)
+			}
+		}
+	}
+}
+
+func (s *kafkaSource) claim(claim sarama.ConsumerGroupClaim) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.claims[claim.Partition()] = &claimedPartition{claim: claim, next: -1}
+}
+
+func (s *kafkaSource) release(claim sarama.ConsumerGroupClaim) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.claims[claim.Partition()]; ok && p.claim == claim {
+		delete(s.claims, claim.Partition())
+	}
+}
+
+func (s *kafkaSource) marked(claim sarama.ConsumerGroupClaim, next int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p, ok := s.claims[claim.Partition()]; ok && p.claim == claim {
+		p.next = next
+	}
+}
+
+// Close stops the consumption, which commits the offsets of the handled messages, and leaves the consumer group.
+func (s *kafkaSource) Close() error {
+	s.cancel()
+	select {
+	case <-s.started:
+		<-s.stopped
+	default:
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.consumerGroup == nil {
+		return nil
+	}
+	return s.consumerGroup.Close()
+}
+
+// ConnectivityCheck checks whether a connection to Kafka can be established.
+func (s *kafkaSource) ConnectivityCheck() error {
+	s.mu.RLock()
+	connected := s.consumerGroup != nil
+	s.mu.RUnlock()
+	if !connected {
+		return kafka.ErrConsumerNotConnected
+	}
+
+	consumerGroup, err := sarama.NewConsumerGroup(s.brokers, fmt.Sprintf("healthcheck-%d", rand.Intn(100)), kafka.DefaultConsumerOptions())
+	if err != nil {
+		return err
+	}
+	_ = consumerGroup.Close()
+	return nil
+}
+
+// MonitorCheck checks whether the consumer lags behind the claimed partitions by more than the lag tolerance.
+func (s *kafkaSource) MonitorCheck() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var lagging []string
+	for partition, p := range s.claims {
+		if p.next < 0 {
+			continue
+		}
+		if lag := p.claim.HighWaterMarkOffset() - p.next; lag > s.lagTolerance {
+			lagging = append(lagging, fmt.Sprintf("consumer is lagging behind for partition %d of topic %q with %d messages", partition, s.topic, lag))
+		}
+	}
+	if len(lagging) > 0 {
+		return errors.New(strings.Join(lagging, ", "))
+	}
+	return nil
+}
+
+// offsetTracker follows the messages of a partition in flight, for the offset of a message to be committed
+// only once the message and all the messages consumed before it are settled.
+type offsetTracker struct {
+	mu       sync.Mutex
+	inFlight []int64
+	settled  map[int64]bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{settled: make(map[int64]bool)}
+}
+
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight = append(t.inFlight, offset)
+}
+
+// settle records that the message is settled, committing the offset following the settled messages when it moved forward.
+func (t *offsetTracker) settle(offset int64, commit func(next int64)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.settled[offset] = true
+	next := int64(-1)
+	for len(t.inFlight) > 0 && t.settled[t.inFlight[0]] {
+		next = t.inFlight[0] + 1
+		delete(t.settled, t.inFlight[0])
+		t.inFlight = t.inFlight[1:]
+	}
+	if next >= 0 {
+		commit(next)
+	}
+}
+
+// settleLater settles the message once its result is received, unless ctx is done before that.
+// A message which failed for another reason than exhausting its redeliveries is left uncommitted.
+func (t *offsetTracker) settleLater(ctx context.Context, offset int64, result <-chan error, commit func(next int64)) {
+	go func() {
+		select {
+		case <-ctx.Done():
+		case err := <-result:
+			if err == nil || errors.Is(err, errRedeliveriesExhausted) {
+				t.settle(offset, commit)
+			}
+		}
+	}()
+}
+
+// decodeFTMessage parses a message in the FT message format: a header line per header, a blank line and the body.
+func decodeFTMessage(raw []byte) Message {
+	msg := string(raw)
+	end, bodyStart := len(msg), len(msg)
+	if i := strings.Index(msg, "\r\n\r\n"); i != -1 {
+		end, bodyStart = i, i+4
+	} else if i := strings.Index(msg, "\n\n"); i != -1 {
+		end, bodyStart = i, i+2
+	}
+
+	headers := make(map[string]string)
+	for _, line := range strings.Split(msg[:end], "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return Message{Headers: headers, Body: strings.TrimSpace(msg[bodyStart:])}
+}
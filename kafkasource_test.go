@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSession stands in for a consumer group session, recording the marked offsets.
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx context.Context
+
+	mu     sync.Mutex
+	marked int64
+}
+
+func (s *fakeSession) Context() context.Context {
+	return s.ctx
+}
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, _ string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, "")
+}
+
+func (s *fakeSession) MarkOffset(_ string, _ int32, offset int64, _ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if offset > s.marked {
+		s.marked = offset
+	}
+}
+
+func (s *fakeSession) markedOffset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.marked
+}
+
+// fakeClaim stands in for the claim of partition 0 of the read topic.
+type fakeClaim struct {
+	sarama.ConsumerGroupClaim
+	messages      chan *sarama.ConsumerMessage
+	highWaterMark int64
+}
+
+func (c *fakeClaim) Topic() string {
+	return "NativeCmsPublicationEvents"
+}
+
+func (c *fakeClaim) Partition() int32 {
+	return 0
+}
+
+func (c *fakeClaim) HighWaterMarkOffset() int64 {
+	return c.highWaterMark
+}
+
+func (c *fakeClaim) Messages() <-chan *sarama.ConsumerMessage {
+	return c.messages
+}
+
+func newFakeClaim(highWaterMark int64, bodies ...string) *fakeClaim {
+	claim := &fakeClaim{messages: make(chan *sarama.ConsumerMessage, len(bodies)), highWaterMark: highWaterMark}
+	for offset, body := range bodies {
+		claim.messages <- &sarama.ConsumerMessage{Offset: int64(offset), Value: []byte("FTMSG/1.0\r\nX-Request-Id: tid_test\r\n\r\n" + body)}
+	}
+	return claim
+}
+
+func newTestKafkaSource(handler func(Message) error) *kafkaSource {
+	return &kafkaSource{
+		topic:        "NativeCmsPublicationEvents",
+		lagTolerance: 1,
+		redelivery:   newTestRedelivery(),
+		handler:      handler,
+		log:          getLogger(),
+		claims:       make(map[int32]*claimedPartition),
+	}
+}
+
+func TestKafkaSourceMarksTheHandledMessages(t *testing.T) {
+	var bodies []string
+	source := newTestKafkaSource(func(m Message) error {
+		bodies = append(bodies, m.Body)
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session := &fakeSession{ctx: ctx}
+	claim := newFakeClaim(5, `{"id":"first"}`, `{"id":"second"}`)
+
+	consumed := make(chan error)
+	go func() { consumed <- source.ConsumeClaim(session, claim) }()
+	require.Eventually(t, func() bool { return session.markedOffset() == 2 }, time.Second, time.Millisecond)
+	assert.EqualError(t, source.MonitorCheck(), `consumer is lagging behind for partition 0 of topic "NativeCmsPublicationEvents" with 3 messages`)
+
+	cancel()
+	require.NoError(t, <-consumed)
+	assert.Equal(t, []string{`{"id":"first"}`, `{"id":"second"}`}, bodies)
+	assert.NoError(t, source.MonitorCheck(), "A released partition should not be monitored")
+}
+
+func TestKafkaSourceLeavesTheMessageUnmarkedWhenTheSessionEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	source := newTestKafkaSource(func(Message) error {
+		attempts++
+		if attempts == 2 {
+			cancel()
+		}
+		return errors.New("produce failed")
+	})
+	session := &fakeSession{ctx: ctx}
+
+	err := source.ConsumeClaim(session, newFakeClaim(1, `{"id":"first"}`))
+	assert.NoError(t, err, "The claim should be released on shutdown or on a rebalance")
+	assert.Zero(t, session.markedOffset(), "A message which was never handled should be left for the next owner of the partition")
+}
+
+func TestKafkaSourceMarksTheAbandonedMessages(t *testing.T) {
+	source := newTestKafkaSource(func(Message) error { return errors.New("message too large") })
+	source.redelivery.maxRedeliveries = 1
+	session := &fakeSession{ctx: context.Background()}
+	claim := newFakeClaim(1, `{"id":"first"}`)
+	close(claim.messages)
+
+	assert.NoError(t, source.ConsumeClaim(session, claim))
+	assert.Equal(t, int64(1), session.markedOffset(), "A message which exhausted its redeliveries should be committed")
+}
+
+func TestKafkaSourceCommitsTheSettledMessagesInOrder(t *testing.T) {
+	results := make(map[string]chan error)
+	source := newTestKafkaSource(func(m Message) error {
+		if m.Body == "handled" {
+			return nil
+		}
+		result := make(chan error, 1)
+		results[m.Body] = result
+		m.settleLater(result)
+		return nil
+	})
+	session := &fakeSession{ctx: context.Background()}
+	claim := newFakeClaim(4, "held", "replaced", "handled", "abandoned")
+	close(claim.messages)
+
+	require.NoError(t, source.ConsumeClaim(session, claim))
+	assert.Zero(t, session.markedOffset(), "No message should be committed before the first one is settled")
+
+	results["replaced"] <- nil
+	results["held"] <- nil
+	require.Eventually(t, func() bool { return session.markedOffset() == 3 }, time.Second, time.Millisecond,
+		"The messages should be committed up to the first one which is not settled")
+
+	results["abandoned"] <- errRedeliveriesExhausted
+	require.Eventually(t, func() bool { return session.markedOffset() == 4 }, time.Second, time.Millisecond,
+		"A message whose redeliveries are exhausted should be committed")
+}
+
+func TestKafkaSourceLeavesTheMessagesWhichFailedLaterUnmarked(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	result := make(chan error, 1)
+	source := newTestKafkaSource(func(m Message) error {
+		m.settleLater(result)
+		return nil
+	})
+	session := &fakeSession{ctx: ctx}
+	claim := newFakeClaim(1, "held")
+	close(claim.messages)
+
+	require.NoError(t, source.ConsumeClaim(session, claim))
+	result <- errors.New("sink is closed")
+	time.Sleep(10 * time.Millisecond)
+	assert.Zero(t, session.markedOffset(), "A message which was not sent should be consumed again")
+}
+
+func TestDecodeFTMessage(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected Message
+	}{
+		{
+			"CRLF",
+			"FTMSG/1.0\r\nX-Request-Id: tid_test\r\nMessage-Timestamp: 2017-04-13T10:27:32.353Z\r\n\r\n{\"id\":\"x\"}\n",
+			Message{Headers: map[string]string{"X-Request-Id": "tid_test", "Message-Timestamp": "2017-04-13T10:27:32.353Z"}, Body: `{"id":"x"}`},
+		},
+		{
+			"LF",
+			"FTMSG/1.0\nOrigin-System-Id: http://cmdb.ft.com/systems/next-video-editor\n\n{}",
+			Message{Headers: map[string]string{"Origin-System-Id": "http://cmdb.ft.com/systems/next-video-editor"}, Body: `{}`},
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, decodeFTMessage([]byte(test.raw)), test.name)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cachedLookup is shared by the lookups on the HTTP endpoints: their results are cached and the calls to the endpoint
+// go through a circuit breaker, while the lookups are counted by result in the given metric.
+type cachedLookup struct {
+	client  *http.Client
+	cache   *lruCache
+	breaker *circuitBreaker
+	counter *prometheus.CounterVec
+}
+
+func newCachedLookup(timeout time.Duration, cacheSize int, cacheTTL time.Duration, breakerThreshold int, lookups *prometheus.CounterVec) *cachedLookup {
+	return &cachedLookup{
+		client:  &http.Client{Timeout: timeout},
+		cache:   newLRUCache(cacheSize, cacheTTL),
+		breaker: newCircuitBreaker(breakerThreshold, conceptBreakerCooldown),
+		counter: lookups,
+	}
+}
+
+// get returns the cached result of the key, or looks it up and caches it. The lookup also returns the label its result is counted with.
+func (l *cachedLookup) get(key string, lookup func() (interface{}, string, error)) (interface{}, error) {
+	if value, ok := l.cached(key); ok {
+		return value, nil
+	}
+
+	var value interface{}
+	var result string
+	err := l.call(1, func() error {
+		var err error
+		value, result, err = lookup()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.store(key, value, result)
+	return value, nil
+}
+
+// cached returns the cached result of the key, counting it as cached.
+func (l *cachedLookup) cached(key string) (interface{}, bool) {
+	value, ok := l.cache.get(key)
+	if ok {
+		l.counter.WithLabelValues(lookupCached).Inc()
+	}
+	return value, ok
+}
+
+// call calls the endpoint to look n keys up through the circuit breaker, counting them as failed when the call can't be made or fails.
+func (l *cachedLookup) call(n int, lookup func() error) error {
+	if !l.breaker.allow() {
+		l.counter.WithLabelValues(lookupFailed).Add(float64(n))
+		return errBreakerOpen
+	}
+	if err := lookup(); err != nil {
+		l.breaker.failure()
+		l.counter.WithLabelValues(lookupFailed).Add(float64(n))
+		return err
+	}
+	l.breaker.success()
+	return nil
+}
+
+// store caches the result of the key, counting it with the result label.
+func (l *cachedLookup) store(key string, value interface{}, result string) {
+	l.cache.set(key, value)
+	l.counter.WithLabelValues(result).Inc()
+}
+
+func knownLookupResult(known bool) string {
+	if known {
+		return lookupKnown
+	}
+	return lookupUnknown
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedLookup(t *testing.T) {
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "test_lookups_total"}, []string{"result"})
+	l := newCachedLookup(time.Second, 10, time.Minute, 1, counter)
+
+	calls := 0
+	lookup := func(value string, err error) func() (interface{}, string, error) {
+		return func() (interface{}, string, error) {
+			calls++
+			return value, knownLookupResult(value != ""), err
+		}
+	}
+
+	value, err := l.get("known", lookup("found", nil))
+	require.NoError(t, err)
+	assert.Equal(t, "found", value)
+	value, err = l.get("known", lookup("", errors.New("should not be looked up")))
+	require.NoError(t, err)
+	assert.Equal(t, "found", value, "A cached result should not be looked up again")
+
+	_, err = l.get("unknown", lookup("", nil))
+	require.NoError(t, err)
+
+	_, err = l.get("failing", lookup("", errors.New("endpoint is down")))
+	assert.EqualError(t, err, "endpoint is down")
+	_, err = l.get("failing", lookup("found", nil))
+	assert.ErrorIs(t, err, errBreakerOpen, "The endpoint should not be called once the breaker is open")
+
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 1.0, testutil.ToFloat64(counter.WithLabelValues(lookupKnown)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(counter.WithLabelValues(lookupUnknown)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(counter.WithLabelValues(lookupCached)))
+	assert.Equal(t, 2.0, testutil.ToFloat64(counter.WithLabelValues(lookupFailed)))
+}
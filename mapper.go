@@ -1,10 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -19,9 +20,18 @@ const (
 type videoMapper struct {
 	sc           serviceConfig
 	strContent   string
+	envelope     string
 	tid          string
+	syntheticTID bool
 	unmarshalled map[string]interface{}
-	log          *logger.UPPLogger
+	quality      *qualityReport
+	conceptTypes map[string]string
+	originalIDs  map[tag]string
+	// annotationIndexes holds the position of each retrieved annotation within the annotations of the Next video
+	annotationIndexes map[tag]int
+	typeViolations    []typeViolation
+	ruleViolations    []ruleViolation
+	log               *logger.UPPLogger
 }
 
 type tag struct {
@@ -29,7 +39,47 @@ type tag struct {
 	predicate string
 }
 
-func (vm *videoMapper) mapNextVideoAnnotations() ([]byte, string, error) {
+// unmarshal decodes the Next video JSON received as string content, unwrapping it from its envelope first.
+func (vm *videoMapper) unmarshal(ctx context.Context) error {
+	_, span := startSpan(ctx, "unmarshal")
+	defer span.End()
+
+	format := vm.envelope
+	if format == "" {
+		format = vm.sc.envelopeFormat
+	}
+	document, format, err := unwrapEnvelope([]byte(vm.strContent), format)
+	span.SetAttributes(attribute.String("envelope", format))
+	if err != nil {
+		me := newMappingError(codeInvalidEnvelope, "", "%s envelope couldn't be unwrapped: %v. Skipping message with tid: %s", format, err, vm.tid).
+			withCause(err)
+		recordSpanError(span, me)
+		return me
+	}
+
+	if err := json.Unmarshal(document, &vm.unmarshalled); err != nil {
+		me := newMappingError(codeInvalidJSON, "", "video JSON from Next couldn't be unmarshalled: %v. Skipping invalid JSON with tid: %s", err, vm.tid).
+			withCause(err)
+		recordSpanError(span, me)
+		return me
+	}
+	return nil
+}
+
+func (vm *videoMapper) mapNextVideoAnnotations(ctx context.Context) (_ []byte, _ string, err error) {
+	ctx, span := startSpan(ctx, "mapNextVideoAnnotations")
+	defer func() {
+		recordSpanError(span, err)
+		span.End()
+	}()
+
+	if err := vm.fetchFullDocument(ctx); err != nil {
+		return nil, "", err
+	}
+	if err := vm.validateInput(); err != nil {
+		return nil, "", err
+	}
+
 	var uuidField string
 
 	if vm.isDeleteEvent() {
@@ -42,12 +92,25 @@ func (vm *videoMapper) mapNextVideoAnnotations() ([]byte, string, error) {
 	if err != nil {
 		return nil, "", err
 	}
+	if videoUUID == "" {
+		return nil, "", nullFieldError(uuidField)
+	}
 	nextAnnsArray, err := getObjectsArrayField(annotationsField, vm.unmarshalled, videoUUID, vm)
 	if err != nil {
 		return nil, videoUUID, err
 	}
 
 	annotations := vm.retrieveAnnotations(nextAnnsArray, videoUUID)
+	annotations = vm.canonicaliseConcepts(ctx, annotations, videoUUID)
+	annotations = vm.checkPredicateTypes(ctx, annotations, videoUUID)
+	annotations, err = vm.resolveConcepts(ctx, annotations, videoUUID)
+	if err != nil {
+		return nil, videoUUID, err
+	}
+	vm.quality.Accepted = len(annotations)
+	if err := vm.quality.checkInvalidAnnotations(vm.sc.maxInvalidAnnotationsPercent, vm.sc.emptyAnnotationsPolicy); err != nil {
+		return nil, videoUUID, err
+	}
 
 	if len(annotations) == 0 {
 		vm.log.WithTransactionID(vm.tid).
@@ -55,54 +118,130 @@ func (vm *videoMapper) mapNextVideoAnnotations() ([]byte, string, error) {
 			Info("No annotation could be retrieved for Next video")
 	}
 
-	conceptAnnotations := createAnnotations(annotations, annsContext{videoUUID: videoUUID, transactionID: vm.tid})
+	conceptAnnotations := createAnnotations(annotations, annsContext{videoUUID: videoUUID, transactionID: vm.tid, originalIDs: vm.originalIDs})
+	conceptAnnotations.Annotations = inferAnnotations(conceptAnnotations.Annotations, vm.sc.inferenceRules)
+	conceptAnnotations.Annotations = vm.addBrandAnnotations(conceptAnnotations.Annotations)
+	conceptAnnotations.Annotations = vm.addAuthorAnnotations(ctx, conceptAnnotations.Annotations, videoUUID)
+
+	if err := vm.checkAnnotationRules(conceptAnnotations.Annotations, videoUUID); err != nil {
+		return nil, videoUUID, err
+	}
 
 	marshalledPubEvent, err := json.Marshal(conceptAnnotations)
 	if err != nil {
 		return nil, videoUUID, err
 	}
+	if err := validateConceptAnnotation(marshalledPubEvent); err != nil {
+		return nil, videoUUID, err
+	}
 
 	return marshalledPubEvent, videoUUID, nil
 }
 
+// validateInput checks the Next video JSON against its schema.
+// Violations are only logged unless strict input validation is configured.
+func (vm *videoMapper) validateInput() error {
+	schema := nextVideoPublishSchema
+	if vm.isDeleteEvent() {
+		schema = nextVideoDeleteSchema
+	}
+
+	err := validateAgainstSchema(schema, vm.unmarshalled, codeSchemaViolation)
+	if err == nil {
+		return nil
+	}
+	if vm.sc.inputValidation == strictValidation {
+		return err
+	}
+	vm.log.WithTransactionID(vm.tid).
+		WithError(err).
+		WithFields(err.logFields()).
+		Warn("Next video JSON does not match its schema, mapping it leniently")
+	return nil
+}
+
+// retrieveAnnotations extracts the valid annotations of the video. Their variant concept IDs and duplicates are reported,
+// and only normalised and skipped when normalising the concept IDs is configured.
+// The concept types given by the annotations are recorded for checking them against their predicates.
+// How each annotation was handled is recorded in the quality report of the videoMapper.
 func (vm *videoMapper) retrieveAnnotations(nextAnnsArray []map[string]interface{}, videoUUID string) []tag {
+	vm.quality = newQualityReport(videoUUID, len(nextAnnsArray))
+	vm.conceptTypes = make(map[string]string)
+	vm.originalIDs = make(map[tag]string)
+	vm.annotationIndexes = make(map[tag]int)
 	var annotations = make([]tag, 0)
-	for _, ann := range nextAnnsArray {
+	seen := make(map[tag]bool)
+	for i, ann := range nextAnnsArray {
 		thingID, err := getRequiredStringField(annotationIDField, ann)
 		if err != nil {
-			vm.log.WithTransactionID(vm.tid).
-				WithUUID(videoUUID).
-				WithError(err).
-				Error("Cannot extract concept id from annotation field")
+			vm.logAnnotationWarning(annotationWarning(err, i), videoUUID, "Cannot extract concept id from annotation field")
 			continue
 		}
 
 		nextAnnPredicate, err := getRequiredStringField(annotationPredicateField, ann)
 		if err != nil {
-			vm.log.WithTransactionID(vm.tid).
-				WithUUID(videoUUID).
-				WithError(err).
-				Error("Cannot extract predicate from annotation field")
+			vm.logAnnotationWarning(annotationWarning(err, i), videoUUID, "Cannot extract predicate from annotation field")
 			continue
 		}
 
 		predicate, ok := getPredicateShortForm(nextAnnPredicate)
 		if !ok {
-			vm.log.WithTransactionID(vm.tid).
-				WithUUID(videoUUID).
-				Errorf("Next video predicate id is not known: %s", nextAnnPredicate)
+			err := newMappingError(codeUnknownPredicate, fieldPath(annotationsField, i, annotationPredicateField),
+				"Next video predicate id is not known: %s", nextAnnPredicate)
+			vm.logAnnotationWarning(annotationWarning(err, i), videoUUID, "Next video predicate id is not known")
 			continue
 		}
 
-		ann := tag{
-			thingID:   thingID,
-			predicate: predicate,
+		normalisedID, normalised := normaliseConceptID(thingID)
+		if normalised {
+			vm.quality.NormalisedIDs++
 		}
-		annotations = append(annotations, ann)
+		if vm.sc.normaliseConceptIDs {
+			thingID = normalisedID
+		}
+		if conceptType := annotationConceptType(ann); conceptType != "" {
+			vm.conceptTypes[thingID] = conceptType
+		}
+
+		key := tag{thingID: normalisedID, predicate: predicate}
+		if seen[key] {
+			vm.quality.duplicate(vm.sc.normaliseConceptIDs)
+			if vm.sc.normaliseConceptIDs {
+				continue
+			}
+		}
+		seen[key] = true
+		retrieved := tag{thingID: thingID, predicate: predicate}
+		if _, ok := vm.annotationIndexes[retrieved]; !ok {
+			vm.annotationIndexes[retrieved] = i
+		}
+		annotations = append(annotations, retrieved)
 	}
+	vm.quality.Accepted = len(annotations)
 	return annotations
 }
 
+func (vm *videoMapper) logAnnotationWarning(me *mappingError, videoUUID string, msg string) {
+	vm.quality.drop(me)
+	recordMappingError(me)
+	vm.log.WithTransactionID(vm.tid).
+		WithUUID(videoUUID).
+		WithError(me).
+		WithFields(me.logFields()).
+		Error(msg)
+}
+
+// annotationWarning scopes an error found in a single annotation to its position within the annotations array.
+// Such errors only drop the annotation rather than the whole video, so they are downgraded to warnings.
+func annotationWarning(err error, index int) *mappingError {
+	me := toMappingError(err)
+	if me.Code != codeUnknownPredicate {
+		me.Field = fieldPath(annotationsField, index) + me.Field
+	}
+	me.Severity = severityWarning
+	return me
+}
+
 func getRequiredStringField(key string, obj map[string]interface{}) (string, error) {
 	valueI, ok := obj[key]
 	if !ok || valueI == nil {
@@ -143,12 +282,12 @@ func getObjectsArrayField(key string, obj map[string]interface{}, videoUUID stri
 	return result, nil
 }
 
-func nullFieldError(fieldKey string) error {
-	return fmt.Errorf("[%s] field of native Next video JSON is missing or is null", fieldKey)
+func nullFieldError(fieldKey string) *mappingError {
+	return newMappingError(codeMissingField, fieldPath(fieldKey), "[%s] field of native Next video JSON is missing or is null", fieldKey)
 }
 
-func wrongFieldTypeError(expectedType, fieldKey string, _ interface{}) error {
-	return fmt.Errorf("[%s] field of native Next video JSON is not of type %s", fieldKey, expectedType)
+func wrongFieldTypeError(expectedType, fieldKey string, _ interface{}) *mappingError {
+	return newMappingError(codeWrongFieldType, fieldPath(fieldKey), "[%s] field of native Next video JSON is not of type %s", fieldKey, expectedType)
 }
 
 func (vm *videoMapper) isDeleteEvent() bool {
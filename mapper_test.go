@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/Financial-Times/go-logger/v2"
@@ -31,6 +34,13 @@ func getLogger() *logger.UPPLogger {
 	return logger.NewUPPLogger("video-annotations-mapper", "Debug")
 }
 
+// startStubServer serves the stub of an API for the duration of the test, returning the URL of the server.
+func startStubServer(stub http.Handler, t *testing.T) string {
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
 func TestBuildAnnotations(t *testing.T) {
 	vm := videoMapper{
 		log: getLogger(),
@@ -79,7 +89,7 @@ func TestMapNextVideoAnnotationsHappyFlow(t *testing.T) {
 		{
 			"next-video-input.json",
 			newStringConceptAnnotation(t, "e2290d14-7e80-4db8-a715-949da4de9a07",
-				[]annotation{{"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "isClassifiedBy", defaultRelevanceScore, defaultConfidenceScore}},
+				[]annotation{{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "isClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}},
 			),
 			"e2290d14-7e80-4db8-a715-949da4de9a07",
 			false,
@@ -97,7 +107,7 @@ func TestMapNextVideoAnnotationsHappyFlow(t *testing.T) {
 			log:          getLogger(),
 		}
 
-		marshalledContent, videoUUID, err := vm.mapNextVideoAnnotations()
+		marshalledContent, videoUUID, err := vm.mapNextVideoAnnotations(context.Background())
 
 		assert.Equal(t, test.expectedContent, string(marshalledContent), "Marshalled content wrong. Input JSON: %s", test.fileName)
 		assert.Equal(t, test.expectedVideoUUID, videoUUID, "Video UUID wrong. Input JSON: %s", test.fileName)
@@ -135,7 +145,7 @@ func TestMapNextVideoAnnotationsMissingFields(t *testing.T) {
 			unmarshalled: nextVideo,
 			log:          getLogger(),
 		}
-		_, _, err = vm.mapNextVideoAnnotations()
+		_, _, err = vm.mapNextVideoAnnotations(context.Background())
 		assert.Equal(t, test.expectedErrStatus, err != nil, "Error status wrong. Input JSON: %s", test.fileName)
 	}
 }
@@ -160,7 +170,7 @@ func TestMapNextVideoAnnotationsDeleteEvent(t *testing.T) {
 			unmarshalled: nextVideo,
 			log:          getLogger(),
 		}
-		marshalledContent, _, err := vm.mapNextVideoAnnotations()
+		marshalledContent, _, err := vm.mapNextVideoAnnotations(context.Background())
 		var concept ConceptAnnotation
 		err = json.Unmarshal(marshalledContent, &concept)
 		assert.Nil(t, err)
@@ -284,3 +294,30 @@ func newStringConceptAnnotation(t *testing.T, videoUUID string, s []annotation)
 	}
 	return string(marshalledContent)
 }
+
+func TestMapNextVideoAnnotationsEmptyAnnotationsPolicy(t *testing.T) {
+	tests := []struct {
+		policy          string
+		expectedIsErr   bool
+		expectedContent string
+	}{
+		{rejectEmptyAnnotations, true, ""},
+		{publishEmptyAnnotations, false, `{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[]}`},
+	}
+
+	for _, test := range tests {
+		nextVideo, err := readContent("golden/all-annotations-invalid.input.json")
+		require.NoError(t, err)
+		vm := videoMapper{
+			sc:           serviceConfig{emptyAnnotationsPolicy: test.policy},
+			unmarshalled: nextVideo,
+			log:          getLogger(),
+		}
+
+		output, _, err := vm.mapNextVideoAnnotations(context.Background())
+		assert.Equal(t, test.expectedIsErr, err != nil, "Error status is wrong. Policy: %s", test.policy)
+		if !test.expectedIsErr {
+			assert.JSONEq(t, test.expectedContent, string(output), "Mapped content is wrong. Policy: %s", test.policy)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "next_video_annotations_mapper"
+
+// Results of the concept existence and concordance lookups.
+const (
+	lookupKnown   = "known"
+	lookupUnknown = "unknown"
+	lookupCached  = "cached"
+	lookupFailed  = "failed"
+
+	lookupRewritten = "rewritten"
+	lookupUnchanged = "unchanged"
+)
+
+// Outcomes of the messages consumed from the queue.
+const (
+	outcomeMapped       = "mapped"
+	outcomeIgnored      = "ignored"
+	outcomeRejected     = "rejected"
+	outcomeFailed       = "failed"
+	outcomeDeadLettered = "dead_lettered"
+	outcomeQuarantined  = "quarantined"
+	outcomeAbandoned    = "abandoned"
+)
+
+var (
+	consumedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "messages_total",
+		Help:      "Messages consumed from the queue, by outcome.",
+	}, []string{"outcome"})
+
+	redeliveredMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "redelivered_messages_total",
+		Help:      "Deliveries of consumed messages which failed to be handled and were delivered again.",
+	})
+
+	mappingErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "mapping_errors_total",
+		Help:      "Mapping errors in the queue and /map paths, by error code and severity.",
+	}, []string{"code", "severity"})
+
+	ruleViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "annotation_rule_violations_total",
+		Help:      "Violations of the annotation rules, by rule and severity.",
+	}, []string{"rule", "severity"})
+
+	conceptLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "concept_lookups_total",
+		Help:      "Concept existence lookups, by result. Cached results are not looked up again.",
+	}, []string{"result"})
+
+	predicateTypeViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "predicate_type_violations_total",
+		Help:      "Annotations dropped because their concept type is not allowed for their predicate, by predicate and concept type.",
+	}, []string{"predicate", "concept_type"})
+
+	derivedAnnotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "derived_annotations_total",
+		Help:      "Annotations derived from the explicit ones by the inference rules, by predicate.",
+	}, []string{"predicate"})
+
+	brandAnnotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "brand_annotations_total",
+		Help:      "Brand annotations added from the series and formats of the videos, by source field and predicate.",
+	}, []string{"field", "predicate"})
+
+	authorAnnotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "author_annotations_total",
+		Help:      "Author annotations added from the bylines and creators of the videos, by source field.",
+	}, []string{"field"})
+
+	personLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "person_lookups_total",
+		Help:      "Lookups of the people credited by the videos on the people endpoint, by result. Cached results are not looked up again.",
+	}, []string{"result"})
+
+	concordanceLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "concordance_lookups_total",
+		Help:      "Concordance lookups of the annotated concepts, by result. Cached results are not looked up again.",
+	}, []string{"result"})
+
+	publicationDecisions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "publication_decisions_total",
+		Help:      "Decisions on publishing the annotations of the mapped videos, by decision, following the unpublished policy.",
+	}, []string{"decision"})
+
+	videoFetches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "video_fetches_total",
+		Help:      "Fetches of the full Next video documents of the events carrying only a reference, by result. Retried requests are counted as retried.",
+	}, []string{"result"})
+
+	coalescedMessages = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "coalesced_messages_total",
+		Help:      "Mapped messages which were not sent because a newer message of the same video replaced them within the coalescing window.",
+	})
+
+	heldMessages = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "held_messages",
+		Help:      "Mapped messages held until the coalescing window of their video is over.",
+	})
+
+	consumptionBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "consumption_breaker_state",
+		Help:      "State of the circuit breaker pausing the consumption while the write queue is unavailable, 1 for the current state.",
+	}, []string{"state"})
+
+	consumptionPauses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "consumption_pauses_total",
+		Help:      "Times the consumption was paused because the write queue was unavailable.",
+	})
+
+	relatedContentFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "related_content_failures_total",
+		Help:      "Curated related content of the mapped videos which could not be sent. The messages are not consumed again for it.",
+	})
+)
+
+func recordMappingError(me *mappingError) {
+	mappingErrors.WithLabelValues(me.Code, me.Severity).Inc()
+}
+
+func recordRuleViolation(v *ruleViolation) {
+	ruleViolations.WithLabelValues(v.Rule, v.Severity).Inc()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+const (
+	stdioPath          = "-"
+	maxNDJSONLineBytes = 10 * 1024 * 1024
+)
+
+// ndjsonMessage is the line format used by the NDJSON source and sink.
+// The body may be given either as a JSON string or as an inline JSON document.
+type ndjsonMessage struct {
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+// ndjsonSource reads one message per line from a file or from stdin.
+type ndjsonSource struct {
+	r          io.ReadCloser
+	redelivery redelivery
+	ctx        context.Context
+	cancel     context.CancelFunc
+	log        *logger.UPPLogger
+}
+
+func newNDJSONSource(path string, maxRedeliveries int, log *logger.UPPLogger) (*ndjsonSource, error) {
+	r := io.NopCloser(os.Stdin)
+	if path != stdioPath {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening NDJSON source %s: %w", path, err)
+		}
+		r = f
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ndjsonSource{r: r, redelivery: newRedelivery(maxRedeliveries, log), ctx: ctx, cancel: cancel, log: log}, nil
+}
+
+// Start reads the input until it is exhausted or the source is closed, delivering each decoded message until it is handled.
+func (s *ndjsonSource) Start(handler func(Message) error) {
+	scanner := bufio.NewScanner(s.r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxNDJSONLineBytes)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		msg, err := decodeNDJSONMessage(scanner.Bytes())
+		if err != nil {
+			s.log.WithError(err).Warnf("Skipping invalid NDJSON message on line %d", line)
+			continue
+		}
+		// there are no offsets to commit, so a result coming after the handler returned is only logged when it failed
+		n := line
+		msg.settle = func(result <-chan error) {
+			go func() {
+				if err := <-result; err != nil {
+					s.log.WithError(err).Errorf("NDJSON message on line %d was not handled", n)
+				}
+			}()
+		}
+		err = s.redelivery.deliver(s.ctx, handler, msg)
+		if errors.Is(err, context.Canceled) {
+			s.log.Warnf("NDJSON source closed before the message on line %d was handled", line)
+			return
+		}
+		if err != nil {
+			s.log.WithError(err).Errorf("NDJSON message on line %d was not handled", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		s.log.WithError(err).Error("Error reading NDJSON source")
+		return
+	}
+	s.log.Infof("NDJSON source exhausted after %d lines", line)
+}
+
+func (s *ndjsonSource) Close() error {
+	s.cancel()
+	return s.r.Close()
+}
+
+func (s *ndjsonSource) ConnectivityCheck() error {
+	return nil
+}
+
+func (s *ndjsonSource) MonitorCheck() error {
+	return nil
+}
+
+func decodeNDJSONMessage(line []byte) (Message, error) {
+	var nm ndjsonMessage
+	if err := json.Unmarshal(line, &nm); err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{Headers: nm.Headers, Body: string(nm.Body)}
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]string)
+	}
+	if len(nm.Body) > 0 && nm.Body[0] == '"' {
+		if err := json.Unmarshal(nm.Body, &msg.Body); err != nil {
+			return Message{}, err
+		}
+	}
+	return msg, nil
+}
+
+// ndjsonSink writes one message per line to a file or to stdout.
+type ndjsonSink struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+func newNDJSONSink(path string) (*ndjsonSink, error) {
+	if path == stdioPath {
+		return &ndjsonSink{w: nopWriteCloser{os.Stdout}}, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening NDJSON sink %s: %w", path, err)
+	}
+	return &ndjsonSink{w: f}, nil
+}
+
+func (s *ndjsonSink) SendMessage(m Message) error {
+	line, err := encodeNDJSONMessage(m)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(line, '\n'))
+	return err
+}
+
+func (s *ndjsonSink) Close() error {
+	return s.w.Close()
+}
+
+func (s *ndjsonSink) ConnectivityCheck() error {
+	return nil
+}
+
+func encodeNDJSONMessage(m Message) ([]byte, error) {
+	body := json.RawMessage(m.Body)
+	if !json.Valid(body) {
+		quoted, err := json.Marshal(m.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = quoted
+	}
+	return json.Marshal(ndjsonMessage{Headers: m.Headers, Body: body})
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeNDJSONMessage(t *testing.T) {
+	tests := []struct {
+		line            string
+		expectedMessage Message
+		expectedIsErr   bool
+	}{
+		{
+			`{"headers":{"X-Request-Id":"tid_1"},"body":"{\"id\":\"1\"}"}`,
+			Message{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: `{"id":"1"}`},
+			false,
+		},
+		{
+			`{"headers":{"X-Request-Id":"tid_1"},"body":{"id":"1"}}`,
+			Message{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: `{"id":"1"}`},
+			false,
+		},
+		{
+			`{"body":"text"}`,
+			Message{Headers: map[string]string{}, Body: "text"},
+			false,
+		},
+		{
+			`not json`,
+			Message{},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		msg, err := decodeNDJSONMessage([]byte(test.line))
+		assert.Equal(t, test.expectedMessage, msg, "Message is wrong. Input line: %s", test.line)
+		assert.Equal(t, test.expectedIsErr, err != nil, "Error status is wrong. Input line: %s", test.line)
+	}
+}
+
+func TestEncodeNDJSONMessage(t *testing.T) {
+	tests := []struct {
+		msg          Message
+		expectedLine string
+	}{
+		{
+			Message{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "{\n  \"uuid\": \"1\"\n}"},
+			`{"headers":{"X-Request-Id":"tid_1"},"body":{"uuid":"1"}}`,
+		},
+		{
+			Message{Headers: map[string]string{"X-Request-Id": "tid_1"}, Body: "not json"},
+			`{"headers":{"X-Request-Id":"tid_1"},"body":"not json"}`,
+		},
+	}
+
+	for _, test := range tests {
+		line, err := encodeNDJSONMessage(test.msg)
+		require.NoError(t, err)
+		assert.Equal(t, test.expectedLine, string(line), "Encoded line is wrong. Input message: %v", test.msg)
+	}
+}
+
+func TestNDJSONPipeline(t *testing.T) {
+	input := string(getBytes("next-video-input.json", t))
+	lines := []Message{
+		{Headers: createHeaders(nextVideoOrigin, "tid_1"), Body: input},
+		{Headers: createHeaders("other", "tid_2"), Body: input},
+	}
+	var in bytes.Buffer
+	for _, msg := range lines {
+		line, err := encodeNDJSONMessage(msg)
+		require.NoError(t, err)
+		in.Write(line)
+		in.WriteString("\n\ninvalid line\n")
+	}
+
+	var out bytes.Buffer
+	source := newTestNDJSONSource(&in)
+	sink := &ndjsonSink{w: nopWriteCloser{&out}}
+	h := newQueueHandler(serviceConfig{}, sink, getLogger())
+
+	source.Start(h.queueConsume)
+
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	var produced []Message
+	for scanner.Scan() {
+		msg, err := decodeNDJSONMessage(scanner.Bytes())
+		require.NoError(t, err)
+		produced = append(produced, msg)
+	}
+	require.Len(t, produced, 1, "Only the Next video message should be mapped")
+
+	var concept ConceptAnnotation
+	require.NoError(t, json.Unmarshal([]byte(produced[0].Body), &concept))
+	assert.Equal(t, "e2290d14-7e80-4db8-a715-949da4de9a07", concept.UUID)
+	assert.Equal(t, "tid_1", produced[0].Headers["X-Request-Id"])
+	assert.Equal(t, generatedMsgType, produced[0].Headers["Message-Type"])
+}
+
+func TestNDJSONSourceRedeliversTheMessagesWhichWereNotHandled(t *testing.T) {
+	var in bytes.Buffer
+	for _, tid := range []string{"tid_1", "tid_2"} {
+		line, err := encodeNDJSONMessage(Message{Headers: createHeaders(nextVideoOrigin, tid), Body: "{}"})
+		require.NoError(t, err)
+		in.Write(append(line, '\n'))
+	}
+
+	var handled []string
+	paused := true
+	source := newTestNDJSONSource(&in)
+	source.Start(func(m Message) error {
+		if paused {
+			paused = false
+			return errConsumptionPaused
+		}
+		handled = append(handled, m.Headers["X-Request-Id"])
+		return nil
+	})
+
+	assert.Equal(t, []string{"tid_1", "tid_2"}, handled, "A message read while the consumption is paused should not be dropped")
+}
+
+func newTestNDJSONSource(r io.Reader) *ndjsonSource {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &ndjsonSource{r: io.NopCloser(r), redelivery: newTestRedelivery(), ctx: ctx, cancel: cancel, log: getLogger()}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// Fields of the Next video whose values are mapped to authors.
+const (
+	bylineField    = "byline"
+	createdByField = "createdBy"
+)
+
+// Kinds of the people looked up: the usernames of the editors and the names in the bylines.
+const (
+	usernameLookup = "username"
+	nameLookup     = "name"
+)
+
+const hasAuthorPredicate = "hasAuthor"
+
+var (
+	bylineClauseEnd  = regexp.MustCompile(`[.;](\s+|$)`)
+	bylineSeparators = regexp.MustCompile(`(?i)\s*(,|&|\band\b)\s*`)
+)
+
+// personLookup finds the UUID of the Person concept of a username or a byline name, returning an empty UUID when it is not known.
+type personLookup interface {
+	personUUID(ctx context.Context, kind, value string) (string, error)
+}
+
+// peopleTable maps the usernames and the byline names to the UUIDs of their Person concepts, e.g.
+// {"usernames": {"seb.morton-clark": "<uuid>"}, "names": {"Seb Morton-Clark": "<uuid>"}}.
+// Both are matched regardless of case and spacing.
+type peopleTable struct {
+	Usernames map[string]string `json:"usernames,omitempty"`
+	Names     map[string]string `json:"names,omitempty"`
+}
+
+// loadPeopleTable reads the people table from a JSON file. An empty path means no table.
+func loadPeopleTable(path string) (*peopleTable, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var table peopleTable
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("people table in %s is not valid JSON: %w", path, err)
+	}
+	if table.Usernames, err = normalisePeople(path, usernameLookup, table.Usernames); err != nil {
+		return nil, err
+	}
+	if table.Names, err = normalisePeople(path, nameLookup, table.Names); err != nil {
+		return nil, err
+	}
+	return &table, nil
+}
+
+// normalisePeople checks the Person UUIDs of the usernames or names, keying them by their normalised values.
+func normalisePeople(path, kind string, people map[string]string) (map[string]string, error) {
+	normalised := make(map[string]string, len(people))
+	for value, personUUID := range people {
+		parsed, err := uuid.Parse(personUUID)
+		if err != nil {
+			return nil, fmt.Errorf("people table in %s maps %s %q to %q, which is not a UUID", path, kind, value, personUUID)
+		}
+		normalised[normalisePersonValue(value)] = parsed.String()
+	}
+	return normalised, nil
+}
+
+func normalisePersonValue(value string) string {
+	return strings.Join(strings.Fields(strings.ToLower(value)), " ")
+}
+
+func (t *peopleTable) personUUID(_ context.Context, kind, value string) (string, error) {
+	if kind == usernameLookup {
+		return t.Usernames[normalisePersonValue(value)], nil
+	}
+	return t.Names[normalisePersonValue(value)], nil
+}
+
+// httpPeopleResolver looks the people up on an HTTP people endpoint, which responds to GET <url>?username=<username>
+// or GET <url>?name=<name> with 200 and the Person concept, holding its uuid or its id, for the known people and 404 for the unknown ones.
+// Both outcomes are cached.
+type httpPeopleResolver struct {
+	url     string
+	lookups *cachedLookup
+}
+
+func newHTTPPeopleResolver(url string, timeout time.Duration, cacheSize int, cacheTTL time.Duration) *httpPeopleResolver {
+	return &httpPeopleResolver{
+		url:     strings.TrimSuffix(url, "/"),
+		lookups: newCachedLookup(timeout, cacheSize, cacheTTL, conceptBreakerThreshold, personLookups),
+	}
+}
+
+func (r *httpPeopleResolver) personUUID(ctx context.Context, kind, value string) (string, error) {
+	personUUID, err := r.lookups.get(kind+":"+normalisePersonValue(value), func() (interface{}, string, error) {
+		personUUID, err := r.lookup(ctx, kind, value)
+		return personUUID, knownLookupResult(personUUID != ""), err
+	})
+	if err != nil {
+		return "", err
+	}
+	return personUUID.(string), nil
+}
+
+func (r *httpPeopleResolver) lookup(ctx context.Context, kind, value string) (string, error) {
+	query := url.Values{kind: []string{strings.TrimSpace(value)}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	injectHTTPTraceContext(ctx, req.Header)
+
+	resp, err := r.lookups.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("people endpoint responded with status %d for %s %q", resp.StatusCode, kind, value)
+	}
+
+	var person struct {
+		UUID string `json:"uuid"`
+		ID   string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&person); err != nil {
+		return "", fmt.Errorf("people endpoint responded with an invalid person for %s %q: %w", kind, value, err)
+	}
+	personUUID := person.UUID
+	if personUUID == "" {
+		personUUID = person.ID[strings.LastIndex(person.ID, "/")+1:]
+	}
+	parsed, err := uuid.Parse(personUUID)
+	if err != nil {
+		return "", fmt.Errorf("people endpoint responded with no person UUID for %s %q", kind, value)
+	}
+	return parsed.String(), nil
+}
+
+// bylineNames splits a byline like "Filmed by Niclola Stansfield. Produced by Seb Morton-Clark and John F. Smith."
+// into the names of the people it credits, dropping the roles they are credited for.
+func bylineNames(byline string) []string {
+	var names []string
+	for _, clause := range bylineClauses(byline) {
+		if i := afterLastBy(clause); i >= 0 {
+			clause = clause[i:]
+		}
+		for _, name := range bylineSeparators.Split(clause, -1) {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// afterLastBy returns the index following the last "by " of the clause which starts it or follows a space,
+// matched regardless of case, or -1 when there is none.
+// The clause is searched as is, since lowercasing it may change the byte offsets of its other characters.
+func afterLastBy(clause string) int {
+	for i := len(clause) - len("by "); i >= 0; i-- {
+		if (i == 0 || clause[i-1] == ' ') && strings.EqualFold(clause[i:i+2], "by") && clause[i+2] == ' ' {
+			return i + len("by ")
+		}
+	}
+	return -1
+}
+
+// bylineClauses splits a byline into its sentences, without splitting the names at their initials.
+func bylineClauses(byline string) []string {
+	var clauses []string
+	start := 0
+	for _, m := range bylineClauseEnd.FindAllStringIndex(byline, -1) {
+		if byline[m[0]] == '.' && endsWithInitial(byline[start:m[0]]) {
+			continue
+		}
+		clauses = append(clauses, byline[start:m[0]])
+		start = m[1]
+	}
+	return append(clauses, byline[start:])
+}
+
+func endsWithInitial(s string) bool {
+	words := strings.Fields(s)
+	return len(words) > 1 && utf8.RuneCountInString(words[len(words)-1]) == 1
+}
+
+// addAuthorAnnotations appends the hasAuthor annotations of the people credited by the byline of the video and of its creator.
+// updatedBy is not mapped, as it holds the last editor of the video rather than one of its authors.
+// The annotations of the editors take precedence: no author annotation is added for a concept already annotated.
+// People that cannot be looked up, because the people endpoint is failing, are skipped.
+func (vm *videoMapper) addAuthorAnnotations(ctx context.Context, annotations []annotation, videoUUID string) []annotation {
+	if vm.sc.people == nil || vm.isDeleteEvent() {
+		return annotations
+	}
+	ctx, span := startSpan(ctx, "addAuthorAnnotations")
+	defer span.End()
+
+	annotated := make(map[string]bool, len(annotations))
+	for _, ann := range annotations {
+		annotated[ann.ID] = true
+	}
+
+	type candidate struct{ field, kind, value string }
+	var candidates []candidate
+	if createdBy, ok := vm.unmarshalled[createdByField].(string); ok && strings.TrimSpace(createdBy) != "" {
+		candidates = append(candidates, candidate{createdByField, usernameLookup, createdBy})
+	}
+	if byline, ok := vm.unmarshalled[bylineField].(string); ok {
+		for _, name := range bylineNames(byline) {
+			candidates = append(candidates, candidate{bylineField, nameLookup, name})
+		}
+	}
+
+	result := annotations
+	for _, c := range candidates {
+		personUUID, err := vm.sc.people.personUUID(ctx, c.kind, c.value)
+		if err != nil {
+			vm.log.WithTransactionID(vm.tid).
+				WithUUID(videoUUID).
+				WithError(err).
+				Warnf("Could not look up the person of %s %q, skipping their author annotation", c.kind, c.value)
+			continue
+		}
+		if personUUID == "" {
+			continue
+		}
+		personID := thingsURIPrefix + personUUID
+		if annotated[personID] {
+			continue
+		}
+		annotated[personID] = true
+		authorAnnotations.WithLabelValues(c.field).Inc()
+		result = append(result, annotation{
+			ID:              personID,
+			Predicate:       hasAuthorPredicate,
+			RelevanceScore:  defaultRelevanceScore,
+			ConfidenceScore: defaultDerivedScore,
+			Derived:         true,
+		})
+	}
+	return result
+}
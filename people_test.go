@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	sebPersonUUID     = "55a4ea7f-47de-4d6b-9d71-e409e5701629"
+	niclolaPersonUUID = "25b50ff1-a436-42a3-b586-9c7bac4672e7"
+	sebPersonID       = "http://api.ft.com/things/" + sebPersonUUID
+	niclolaPersonID   = "http://api.ft.com/things/" + niclolaPersonUUID
+	bylineVideoBody   = `{"id": "e2290d14-7e80-4db8-a715-949da4de9a07", "createdBy": "seb.morton-clark", "updatedBy": "someone.else",
+		"byline": "Filmed by Niclola Stansfield. Produced by Seb Morton-Clark."}`
+)
+
+// peopleAPIStub stands in for the people endpoint, knowing the people of test-resources/people.json.
+type peopleAPIStub struct {
+	mu       sync.Mutex
+	requests int
+	status   int
+	table    *peopleTable
+}
+
+func (s *peopleAPIStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	status := s.status
+	s.mu.Unlock()
+
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	personUUID, _ := s.table.personUUID(r.Context(), nameLookup, r.URL.Query().Get(nameLookup))
+	if username := r.URL.Query().Get(usernameLookup); username != "" {
+		personUUID, _ = s.table.personUUID(r.Context(), usernameLookup, username)
+	}
+	if personUUID == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, _ = w.Write([]byte(`{"id":"http://api.ft.com/things/` + personUUID + `","type":"http://www.ft.com/ontology/person/Person"}`))
+}
+
+func (s *peopleAPIStub) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestLoadPeopleTable(t *testing.T) {
+	table, err := loadPeopleTable("test-resources/people.json")
+	require.NoError(t, err)
+	personUUID, err := table.personUUID(context.Background(), nameLookup, "  seb   MORTON-clark ")
+	assert.NoError(t, err)
+	assert.Equal(t, sebPersonUUID, personUUID, "Names should be matched regardless of case and spacing")
+	personUUID, _ = table.personUUID(context.Background(), usernameLookup, "Seb Morton-Clark")
+	assert.Empty(t, personUUID, "Names should not be matched as usernames")
+
+	table, err = loadPeopleTable("")
+	assert.NoError(t, err)
+	assert.Nil(t, table)
+
+	path := filepath.Join(t.TempDir(), "people.json")
+	for _, invalid := range []string{
+		`not json`,
+		`{"usernames": {"seb.morton-clark": "not-a-uuid"}}`,
+		`{"names": {"Seb Morton-Clark": "not-a-uuid"}}`,
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := loadPeopleTable(path)
+		assert.Error(t, err, "People table should be rejected: %s", invalid)
+	}
+}
+
+func TestBylineNames(t *testing.T) {
+	tests := []struct {
+		byline   string
+		expected []string
+	}{
+		{"Filmed by Niclola Stansfield. Produced by Seb Morton-Clark.", []string{"Niclola Stansfield", "Seb Morton-Clark"}},
+		{"By Seb Morton-Clark", []string{"Seb Morton-Clark"}},
+		{"Produced by Seb Morton-Clark and Niclola Stansfield; edited by John F. Smith, Ana Ray & Alexandra Andrews", []string{"Seb Morton-Clark", "Niclola Stansfield", "John F. Smith", "Ana Ray", "Alexandra Andrews"}},
+		{"Niclola Stansfield", []string{"Niclola Stansfield"}},
+		{"FILMED BY Niclola Stansfield", []string{"Niclola Stansfield"}},
+		{"Filmed by by Niclola Stansfield", []string{"Niclola Stansfield"}},
+		{"ȺȺȺȺȺȺȺȺ by x", []string{"x"}},
+		{"İİİİİİ by x", []string{"x"}},
+		{"Filmed by İlkay Gündoğan", []string{"İlkay Gündoğan"}},
+		{"", nil},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, bylineNames(test.byline), "Wrong names for byline %q", test.byline)
+	}
+}
+
+func TestHTTPPeopleResolver(t *testing.T) {
+	table, err := loadPeopleTable("test-resources/people.json")
+	require.NoError(t, err)
+	stub := &peopleAPIStub{table: table}
+	resolver := newHTTPPeopleResolver(startStubServer(stub, t)+"/people/", 100*time.Millisecond, 10, time.Minute)
+
+	personUUID, err := resolver.personUUID(context.Background(), usernameLookup, "seb.morton-clark")
+	assert.NoError(t, err)
+	assert.Equal(t, sebPersonUUID, personUUID)
+
+	personUUID, err = resolver.personUUID(context.Background(), nameLookup, "Niclola Stansfield")
+	assert.NoError(t, err)
+	assert.Equal(t, niclolaPersonUUID, personUUID)
+
+	personUUID, err = resolver.personUUID(context.Background(), nameLookup, "Nobody Known")
+	assert.NoError(t, err)
+	assert.Empty(t, personUUID)
+
+	_, _ = resolver.personUUID(context.Background(), nameLookup, "niclola stansfield")
+	_, _ = resolver.personUUID(context.Background(), nameLookup, "Nobody Known")
+	assert.Equal(t, 3, stub.requestCount(), "Both known and unknown people should be cached")
+
+	stub.status = http.StatusInternalServerError
+	_, err = resolver.personUUID(context.Background(), nameLookup, "Someone Else")
+	assert.Error(t, err)
+}
+
+func TestAddAuthorAnnotations(t *testing.T) {
+	table, err := loadPeopleTable("test-resources/people.json")
+	require.NoError(t, err)
+	resolver := newHTTPPeopleResolver(startStubServer(&peopleAPIStub{table: table}, t)+"/people/", 100*time.Millisecond, 10, time.Minute)
+
+	explicit := annotation{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "about", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}
+	seb := annotation{ID: sebPersonID, Predicate: hasAuthorPredicate, RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultDerivedScore, Derived: true}
+	niclola := annotation{ID: niclolaPersonID, Predicate: hasAuthorPredicate, RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultDerivedScore, Derived: true}
+	editorial := annotation{ID: sebPersonID, Predicate: hasAuthorPredicate, RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}
+	tests := []struct {
+		name     string
+		video    string
+		explicit []annotation
+		expected []annotation
+	}{
+		{"creator and byline", bylineVideoBody, []annotation{explicit}, []annotation{explicit, seb, niclola}},
+		{"byline only", `{"byline": "By Niclola Stansfield and Someone Unknown"}`, []annotation{explicit}, []annotation{explicit, niclola}},
+		{"editor's author", bylineVideoBody, []annotation{editorial}, []annotation{editorial, niclola}},
+		{"no byline nor creator", `{"updatedBy": "seb.morton-clark"}`, []annotation{explicit}, []annotation{explicit}},
+		{"delete event", `{"deleted": true, "createdBy": "seb.morton-clark"}`, []annotation{explicit}, []annotation{explicit}},
+	}
+
+	for _, people := range []personLookup{table, resolver} {
+		for _, test := range tests {
+			vm := videoMapper{sc: serviceConfig{people: people}, log: getLogger()}
+			require.NoError(t, json.Unmarshal([]byte(test.video), &vm.unmarshalled))
+			assert.Equal(t, test.expected, vm.addAuthorAnnotations(context.Background(), test.explicit, "e2290d14-7e80-4db8-a715-949da4de9a07"), "%T: %s", people, test.name)
+		}
+	}
+
+	vm := videoMapper{unmarshalled: map[string]interface{}{createdByField: "seb.morton-clark"}}
+	assert.Equal(t, []annotation{explicit}, vm.addAuthorAnnotations(context.Background(), []annotation{explicit}, ""), "No authors should be added without a people lookup")
+}
+
+func TestAddAuthorAnnotationsSkipsFailedLookups(t *testing.T) {
+	stub := &peopleAPIStub{status: http.StatusServiceUnavailable}
+	resolver := newHTTPPeopleResolver(startStubServer(stub, t)+"/people/", 100*time.Millisecond, 10, time.Minute)
+
+	vm := videoMapper{sc: serviceConfig{people: resolver}, log: getLogger()}
+	require.NoError(t, json.Unmarshal([]byte(bylineVideoBody), &vm.unmarshalled))
+	assert.Empty(t, vm.addAuthorAnnotations(context.Background(), nil, "e2290d14-7e80-4db8-a715-949da4de9a07"))
+}
+
+func TestMapNextVideoAnnotationsAddsAuthors(t *testing.T) {
+	table, err := loadPeopleTable("test-resources/people.json")
+	require.NoError(t, err)
+
+	vm := videoMapper{sc: serviceConfig{people: table}, strContent: string(getBytes("next-video-input.json", t)), log: getLogger()}
+	require.NoError(t, vm.unmarshal(context.Background()))
+	content, _, err := vm.mapNextVideoAnnotations(context.Background())
+	require.NoError(t, err, "The author annotations should be valid output")
+
+	assert.JSONEq(t, `{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+		{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"isClassifiedBy","relevanceScore":0.9,"confidenceScore":0.9},
+		{"id":"`+sebPersonID+`","predicate":"hasAuthor","relevanceScore":0.9,"confidenceScore":0.5,"derived":true},
+		{"id":"`+niclolaPersonID+`","predicate":"hasAuthor","relevanceScore":0.9,"confidenceScore":0.5,"derived":true}]}`, string(content))
+}
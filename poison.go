@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"sync"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+var errNoDeadLetterQueue = errors.New("no dead-letter queue is configured to quarantine the message to")
+
+// Headers describing why a poison message was quarantined, in addition to the dead-letter headers.
+const (
+	fingerprintHeader  = "X-Message-Fingerprint"
+	failureCountHeader = "X-Failure-Count"
+	errorStackHeader   = "X-Error-Stack"
+)
+
+// poisonDiagnostics describes the repeated failures of a poison message.
+type poisonDiagnostics struct {
+	fingerprint string
+	failures    int
+	lastErr     error
+	stack       string
+}
+
+func (d poisonDiagnostics) logFields() map[string]interface{} {
+	return map[string]interface{}{
+		"message_fingerprint": d.fingerprint,
+		"failure_count":       d.failures,
+	}
+}
+
+// poisonMessageGuard keeps a single message which always fails, or panics, from blocking the consumption forever.
+// It counts the failures of each message by its fingerprint and, once they reach the threshold, quarantines the message
+// so the consumer can move on. Failures while the write queue is unavailable are not the fault of the message
+// and are not counted, they pause the consumption instead.
+type poisonMessageGuard struct {
+	threshold  int
+	producer   messageProducerHealthcheck
+	quarantine func(Message, poisonDiagnostics) error
+	log        *logger.UPPLogger
+
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func newPoisonMessageGuard(threshold int, producer messageProducerHealthcheck, quarantine func(Message, poisonDiagnostics) error, log *logger.UPPLogger) *poisonMessageGuard {
+	return &poisonMessageGuard{
+		threshold:  threshold,
+		producer:   producer,
+		quarantine: quarantine,
+		log:        log,
+		failures:   make(map[string]int),
+	}
+}
+
+// messageFingerprint identifies a message by its Message-Id and the hash of its body.
+func messageFingerprint(m Message) string {
+	hash := sha256.Sum256([]byte(m.Body))
+	return m.Headers["Message-Id"] + ":" + hex.EncodeToString(hash[:])
+}
+
+// guard wraps a message handler, recovering its panics and quarantining the messages which failed too many times.
+func (g *poisonMessageGuard) guard(handler func(Message) error) func(Message) error {
+	return func(m Message) error {
+		fingerprint := messageFingerprint(m)
+		err, stack := g.handle(handler, m)
+		if err == nil {
+			g.forget(fingerprint)
+			return nil
+		}
+		if stack == "" && g.producer.ConnectivityCheck() != nil {
+			return err
+		}
+
+		failures := g.fail(fingerprint)
+		if failures < g.threshold {
+			return err
+		}
+		d := poisonDiagnostics{fingerprint: fingerprint, failures: failures, lastErr: err, stack: stack}
+		if qErr := g.quarantine(m, d); qErr != nil {
+			return qErr
+		}
+		g.forget(fingerprint)
+		return nil
+	}
+}
+
+func (g *poisonMessageGuard) handle(handler func(Message) error, m Message) (err error, stack string) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handling the message panicked: %v", r)
+			stack = string(debug.Stack())
+			g.log.WithTransactionID(m.Headers["X-Request-Id"]).
+				WithError(err).
+				Error("Recovered from a panic while handling the message")
+		}
+	}()
+	return handler(m), ""
+}
+
+func (g *poisonMessageGuard) fail(fingerprint string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failures[fingerprint]++
+	return g.failures[fingerprint]
+}
+
+func (g *poisonMessageGuard) forget(fingerprint string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.failures, fingerprint)
+}
+
+// quarantine sends a poison message to the dead-letter sink with the diagnostics of its failures.
+// Without a dead-letter sink the message can't be quarantined and is delivered again.
+func (h *queueHandler) quarantine(m Message, d poisonDiagnostics) error {
+	if h.deadLetterProducer == nil {
+		return errNoDeadLetterQueue
+	}
+
+	tid := m.Headers["X-Request-Id"]
+	me := newMappingError(codePoisonMessage, "", "message failed %d times, last with: %v", d.failures, d.lastErr).withCause(d.lastErr)
+	recordMappingError(me)
+	h.log.WithTransactionID(tid).
+		WithError(d.lastErr).
+		WithFields(me.logFields()).
+		WithFields(d.logFields()).
+		Error("Quarantining poison message")
+
+	if err := h.sendDeadLetter(context.Background(), newPoisonMessage(m, me, d), tid, me); err != nil {
+		return err
+	}
+	consumedMessages.WithLabelValues(outcomeQuarantined).Inc()
+	return nil
+}
+
+// newPoisonMessage returns the dead-letter message of a quarantined poison message.
+func newPoisonMessage(m Message, me *mappingError, d poisonDiagnostics) Message {
+	dlm := newDeadLetterMessage(m, me)
+	dlm.Headers[fingerprintHeader] = d.fingerprint
+	dlm.Headers[failureCountHeader] = strconv.Itoa(d.failures)
+	if d.stack != "" {
+		dlm.Headers[errorStackHeader] = d.stack
+	}
+	return dlm
+}
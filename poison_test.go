@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageFingerprint(t *testing.T) {
+	m := Message{Headers: map[string]string{"Message-Id": "msg-1"}, Body: `{"id":"1"}`}
+
+	assert.Equal(t, messageFingerprint(m), messageFingerprint(Message{Headers: map[string]string{"Message-Id": "msg-1"}, Body: `{"id":"1"}`}))
+	assert.NotEqual(t, messageFingerprint(m), messageFingerprint(Message{Headers: map[string]string{"Message-Id": "msg-2"}, Body: `{"id":"1"}`}),
+		"Messages with different IDs should have different fingerprints")
+	assert.NotEqual(t, messageFingerprint(m), messageFingerprint(Message{Headers: map[string]string{"Message-Id": "msg-1"}, Body: `{"id":"2"}`}),
+		"Messages with different bodies should have different fingerprints")
+}
+
+func TestPoisonMessageGuardQuarantinesAfterThreshold(t *testing.T) {
+	var quarantined []poisonDiagnostics
+	g := newPoisonMessageGuard(3, &mockProducerInstance{isConnectionHealthy: true}, func(_ Message, d poisonDiagnostics) error {
+		quarantined = append(quarantined, d)
+		return nil
+	}, getLogger())
+	guarded := g.guard(func(Message) error { return errors.New("message too large") })
+
+	m := Message{Headers: map[string]string{"Message-Id": "msg-1"}, Body: "poison"}
+	assert.Error(t, guarded(m))
+	assert.Error(t, guarded(m))
+	assert.Empty(t, quarantined, "The message should be delivered again below the threshold")
+
+	assert.NoError(t, guarded(m), "The consumer should move on once the message is quarantined")
+	require.Len(t, quarantined, 1)
+	assert.Equal(t, 3, quarantined[0].failures)
+	assert.Equal(t, messageFingerprint(m), quarantined[0].fingerprint)
+	assert.EqualError(t, quarantined[0].lastErr, "message too large")
+	assert.Empty(t, g.failures, "The failures of a quarantined message should be forgotten")
+}
+
+func TestPoisonMessageGuardIgnoresFailuresWhileWriteQueueIsUnavailable(t *testing.T) {
+	producer := &mockProducerInstance{isConnectionHealthy: false}
+	quarantined := 0
+	g := newPoisonMessageGuard(1, producer, func(Message, poisonDiagnostics) error {
+		quarantined++
+		return nil
+	}, getLogger())
+	guarded := g.guard(func(Message) error { return errors.New("producer is unavailable") })
+
+	assert.Error(t, guarded(Message{Body: "healthy"}))
+	assert.Error(t, guarded(Message{Body: "healthy"}))
+	assert.Zero(t, quarantined, "Failures caused by the write queue should not count against the message")
+}
+
+func TestPoisonMessageGuardRecoversPanics(t *testing.T) {
+	var quarantined []poisonDiagnostics
+	g := newPoisonMessageGuard(2, &mockProducerInstance{isConnectionHealthy: false}, func(_ Message, d poisonDiagnostics) error {
+		quarantined = append(quarantined, d)
+		return nil
+	}, getLogger())
+	guarded := g.guard(func(Message) error { panic("boom") })
+
+	assert.EqualError(t, guarded(Message{Body: "crash"}), "handling the message panicked: boom")
+	assert.NoError(t, guarded(Message{Body: "crash"}))
+	require.Len(t, quarantined, 1, "A panicking message should be quarantined regardless of the write queue")
+	assert.Contains(t, quarantined[0].stack, "poison_test.go")
+}
+
+func TestPoisonMessageGuardForgetsHandledMessages(t *testing.T) {
+	quarantined := 0
+	g := newPoisonMessageGuard(2, &mockProducerInstance{isConnectionHealthy: true}, func(Message, poisonDiagnostics) error {
+		quarantined++
+		return nil
+	}, getLogger())
+	fail := true
+	guarded := g.guard(func(Message) error {
+		if fail {
+			return errors.New("transient failure")
+		}
+		return nil
+	})
+
+	assert.Error(t, guarded(Message{Body: "flaky"}))
+	fail = false
+	assert.NoError(t, guarded(Message{Body: "flaky"}))
+	fail = true
+	assert.Error(t, guarded(Message{Body: "flaky"}), "The failures should be counted again once the message was handled")
+	assert.Zero(t, quarantined)
+}
+
+func TestQueueHandlerQuarantine(t *testing.T) {
+	deadLetter := mockMessageProducer{}
+	h := newQueueHandler(serviceConfig{}, &mockMessageProducer{}, getLogger())
+	h.deadLetterProducer = &deadLetter
+
+	before := testutil.ToFloat64(consumedMessages.WithLabelValues(outcomeQuarantined))
+	m := Message{Headers: createHeaders(nextVideoOrigin, "tid_poison"), Body: "poison"}
+	err := h.quarantine(m, poisonDiagnostics{fingerprint: "msg-1:abc", failures: 5, lastErr: errors.New("message too large"), stack: "goroutine 1"})
+
+	require.NoError(t, err)
+	assert.Equal(t, before+1, testutil.ToFloat64(consumedMessages.WithLabelValues(outcomeQuarantined)))
+	assert.Equal(t, "poison", deadLetter.message, "The original body should be quarantined")
+	assert.Equal(t, codePoisonMessage, deadLetter.headers[errorCodeHeader])
+	assert.Equal(t, "message failed 5 times, last with: message too large", deadLetter.headers[errorMessageHeader])
+	assert.Equal(t, "msg-1:abc", deadLetter.headers[fingerprintHeader])
+	assert.Equal(t, "5", deadLetter.headers[failureCountHeader])
+	assert.Equal(t, "goroutine 1", deadLetter.headers[errorStackHeader])
+	assert.Equal(t, "tid_poison", deadLetter.headers["X-Request-Id"])
+
+	err = newQueueHandler(serviceConfig{}, &mockMessageProducer{}, getLogger()).
+		quarantine(m, poisonDiagnostics{failures: 5, lastErr: errors.New("message too large")})
+	assert.ErrorIs(t, err, errNoDeadLetterQueue, "Without a dead-letter queue the poison message should be delivered again rather than lost")
+
+	h.deadLetterProducer = failingMessageProducer{}
+	assert.Error(t, h.quarantine(m, poisonDiagnostics{failures: 5, lastErr: errors.New("message too large")}),
+		"The message should be delivered again when it can't be quarantined")
+}
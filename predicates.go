@@ -9,6 +9,21 @@ var predicates = map[string]string{
 	"http://www.ft.com/ontology/annotation/hasAuthor":                   "hasAuthor",
 }
 
+// derivedOnlyPredicates are written on the concept annotations topic, but only by the mapper itself, never by Next.
+var derivedOnlyPredicates = []string{"hasBrand"}
+
+// shortPredicates is the set of the predicates as written on the concept annotations topic.
+var shortPredicates = func() map[string]struct{} {
+	result := make(map[string]struct{})
+	for _, p := range predicates {
+		result[p] = struct{}{}
+	}
+	for _, p := range derivedOnlyPredicates {
+		result[p] = struct{}{}
+	}
+	return result
+}()
+
 func getPredicateShortForm(nextAnnPredicate string) (string, bool) {
 	predicate, ok := predicates[nextAnnPredicate]
 	return predicate, ok
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// predicateTypeMatrix holds the concept types allowed for each predicate, e.g. hasAuthor only to a Person.
+// Predicates missing from the matrix may point to concepts of any type.
+type predicateTypeMatrix map[string][]string
+
+// typeViolation describes an annotation dropped because its concept is of a type not allowed for its predicate.
+type typeViolation struct {
+	Field        string   `json:"field"`
+	ConceptID    string   `json:"conceptId"`
+	Predicate    string   `json:"predicate"`
+	ConceptType  string   `json:"conceptType"`
+	AllowedTypes []string `json:"allowedTypes"`
+}
+
+// loadPredicateTypes reads the matrix of the allowed concept types per predicate from a JSON file,
+// e.g. {"hasAuthor": ["http://www.ft.com/ontology/person/Person"]}. An empty path means no constraints.
+func loadPredicateTypes(path string) (predicateTypeMatrix, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var matrix predicateTypeMatrix
+	if err := json.Unmarshal(data, &matrix); err != nil {
+		return nil, fmt.Errorf("predicate types in %s are not valid JSON: %w", path, err)
+	}
+	for predicate, types := range matrix {
+		if _, known := shortPredicates[predicate]; !known {
+			return nil, fmt.Errorf("predicate types in %s use unknown predicate %q", path, predicate)
+		}
+		if len(types) == 0 {
+			return nil, fmt.Errorf("predicate types in %s allow no concept type for predicate %q", path, predicate)
+		}
+	}
+	return matrix, nil
+}
+
+func (m predicateTypeMatrix) constrains(predicate string) bool {
+	_, ok := m[predicate]
+	return ok
+}
+
+// allows tells whether the predicate may point to a concept of the given type. Concepts of unknown type are allowed.
+func (m predicateTypeMatrix) allows(predicate, conceptType string) bool {
+	allowed, ok := m[predicate]
+	if !ok || conceptType == "" {
+		return true
+	}
+	for _, t := range allowed {
+		if conceptTypeShortForm(t) == conceptType {
+			return true
+		}
+	}
+	return false
+}
+
+// conceptTypeLookupConcurrency bounds the concurrent lookups of the concept types of a single video.
+const conceptTypeLookupConcurrency = 8
+
+// annotationConceptType returns the short form of the type of the annotated concept taken from the type field
+// of the Next annotation. An empty type means that it is not known.
+func annotationConceptType(ann map[string]interface{}) string {
+	if conceptType, ok := ann[annotationTypeField].(string); ok && conceptType != "" {
+		return conceptTypeShortForm(conceptType)
+	}
+	return ""
+}
+
+// checkPredicateTypes drops the annotations whose concept is of a type not allowed for their predicate.
+// The types not given by the Next annotations are looked up once per canonical concept, concurrently.
+// Concepts whose type cannot be looked up are of unknown type, so their annotations are kept.
+func (vm *videoMapper) checkPredicateTypes(ctx context.Context, annotations []tag, videoUUID string) []tag {
+	if len(vm.sc.predicateTypes) == 0 {
+		return annotations
+	}
+	vm.lookUpConceptTypes(ctx, annotations, videoUUID)
+
+	checked := make([]tag, 0, len(annotations))
+	for _, ann := range annotations {
+		if err := vm.checkPredicateType(ann, vm.conceptTypes[ann.thingID]); err != nil {
+			vm.logAnnotationWarning(err, videoUUID, "Concept type is not allowed for the predicate")
+			continue
+		}
+		checked = append(checked, ann)
+	}
+	return checked
+}
+
+// lookUpConceptTypes records the types of the concepts of the constrained predicates whose type is not known yet.
+func (vm *videoMapper) lookUpConceptTypes(ctx context.Context, annotations []tag, videoUUID string) {
+	if vm.sc.conceptTypeLookup == nil {
+		return
+	}
+	var thingIDs []string
+	requested := make(map[string]bool)
+	for _, ann := range annotations {
+		if _, known := vm.conceptTypes[ann.thingID]; known || requested[ann.thingID] || !vm.sc.predicateTypes.constrains(ann.predicate) {
+			continue
+		}
+		if conceptIDPattern.MatchString(ann.thingID) {
+			requested[ann.thingID] = true
+			thingIDs = append(thingIDs, ann.thingID)
+		}
+	}
+	if len(thingIDs) == 0 {
+		return
+	}
+	ctx, span := startSpan(ctx, "lookUpConceptTypes")
+	defer span.End()
+
+	conceptTypes := make([]string, len(thingIDs))
+	errs := make([]error, len(thingIDs))
+	sem := make(chan struct{}, conceptTypeLookupConcurrency)
+	var wg sync.WaitGroup
+	for i, thingID := range thingIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, thingID string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			conceptUUID := strings.ToLower(conceptIDPattern.FindStringSubmatch(thingID)[1])
+			conceptTypes[i], errs[i] = vm.sc.conceptTypeLookup.conceptType(ctx, conceptUUID)
+		}(i, thingID)
+	}
+	wg.Wait()
+
+	for i, thingID := range thingIDs {
+		if errs[i] != nil {
+			vm.log.WithTransactionID(vm.tid).
+				WithUUID(videoUUID).
+				WithError(errs[i]).
+				Warnf("Could not look up the type of concept %s", thingID)
+			continue
+		}
+		if conceptType := conceptTypeShortForm(conceptTypes[i]); conceptType != "" {
+			vm.conceptTypes[thingID] = conceptType
+		}
+	}
+}
+
+// checkPredicateType returns the mappingError of an annotation whose concept type is not allowed for its predicate,
+// recording the violation on the videoMapper. The error points to the Next annotation the annotation was retrieved from.
+func (vm *videoMapper) checkPredicateType(ann tag, conceptType string) *mappingError {
+	if vm.sc.predicateTypes.allows(ann.predicate, conceptType) {
+		return nil
+	}
+	retrieved := ann
+	if originalID, ok := vm.originalIDs[ann]; ok {
+		retrieved.thingID = originalID
+	}
+	v := typeViolation{
+		Field:        fieldPath(annotationsField, vm.annotationIndexes[retrieved]),
+		ConceptID:    ann.thingID,
+		Predicate:    ann.predicate,
+		ConceptType:  conceptType,
+		AllowedTypes: vm.sc.predicateTypes[ann.predicate],
+	}
+	vm.typeViolations = append(vm.typeViolations, v)
+	predicateTypeViolations.WithLabelValues(ann.predicate, conceptType).Inc()
+	me := newMappingError(codeInvalidConceptType, v.Field,
+		"%s annotation points to %s of type %s, expected %s", ann.predicate, ann.thingID, conceptType, strings.Join(v.AllowedTypes, " or "))
+	me.Severity = severityWarning
+	return me
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockConceptTypeLookup struct {
+	mu      sync.Mutex
+	types   map[string]string
+	lookups []string
+}
+
+func (m *mockConceptTypeLookup) conceptType(_ context.Context, conceptUUID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lookups = append(m.lookups, conceptUUID)
+	conceptType, ok := m.types[conceptUUID]
+	if !ok {
+		return "", errors.New("lookup failed")
+	}
+	return conceptType, nil
+}
+
+func TestLoadPredicateTypes(t *testing.T) {
+	matrix, err := loadPredicateTypes("test-resources/predicate-types.json")
+	require.NoError(t, err)
+	assert.True(t, matrix.constrains("hasAuthor"))
+	assert.False(t, matrix.constrains("mentions"))
+
+	matrix, err = loadPredicateTypes("")
+	assert.NoError(t, err)
+	assert.Nil(t, matrix)
+
+	for _, invalid := range []string{`not json`, `{"unknownPredicate":["Person"]}`, `{"hasAuthor":[]}`} {
+		path := filepath.Join(t.TempDir(), "predicate-types.json")
+		require.NoError(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := loadPredicateTypes(path)
+		assert.Error(t, err, "Predicate types should be rejected: %s", invalid)
+	}
+}
+
+func TestPredicateTypeMatrixAllows(t *testing.T) {
+	matrix, err := loadPredicateTypes("test-resources/predicate-types.json")
+	require.NoError(t, err)
+
+	tests := []struct {
+		predicate   string
+		conceptType string
+		expected    bool
+	}{
+		{"hasAuthor", "Person", true},
+		{"hasAuthor", "Organisation", false},
+		{"isClassifiedBy", "Person", false},
+		{"isClassifiedBy", "Brand", true},
+		{"hasAuthor", "", true},
+		{"mentions", "Organisation", true},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, matrix.allows(test.predicate, test.conceptType), "Wrong result. Predicate: %s, type: %s", test.predicate, test.conceptType)
+	}
+}
+
+func TestCheckPredicateTypes(t *testing.T) {
+	matrix, err := loadPredicateTypes("test-resources/predicate-types.json")
+	require.NoError(t, err)
+	lookup := &mockConceptTypeLookup{types: map[string]string{
+		"71a5efa5-e6e0-3ce1-9190-a7eac8bef325": "http://www.ft.com/ontology/person/Person",
+		"d969d76e-f8f4-34ae-bc38-95cfd0884740": "http://www.ft.com/ontology/organisation/Organisation",
+	}}
+	concordances := concordanceResolverFunc(func(_ context.Context, conceptUUIDs []string) (map[string]string, error) {
+		canonicals := make(map[string]string, len(conceptUUIDs))
+		for _, conceptUUID := range conceptUUIDs {
+			canonicals[conceptUUID] = conceptUUID
+		}
+		canonicals["0f0c8c8a-5a4f-4b4c-8c1e-2b4c52ed4a0b"] = "d969d76e-f8f4-34ae-bc38-95cfd0884740"
+		return canonicals, nil
+	})
+	vm := videoMapper{
+		sc:  serviceConfig{predicateTypes: matrix, conceptTypeLookup: lookup, concordanceResolver: concordances},
+		log: getLogger(),
+	}
+	nextAnns := []map[string]interface{}{
+		newNextAnnotation("http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "http://www.ft.com/ontology/annotation/hasAuthor"),
+		newNextAnnotation("http://api.ft.com/things/0f0c8c8a-5a4f-4b4c-8c1e-2b4c52ed4a0b", "http://www.ft.com/ontology/annotation/hasAuthor"),
+		newNextAnnotation("http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740", "http://www.ft.com/ontology/annotation/mentions"),
+		newNextAnnotation("http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "http://www.ft.com/ontology/annotation/about"),
+		newNextAnnotation("http://api.ft.com/things/e3e2b3b4-6b4a-4c4e-9e4c-6b0e4f3e6c1d", "http://www.ft.com/ontology/annotation/hasAuthor"),
+		{
+			"id":        "http://api.ft.com/things/b43f1a91-b805-3453-8c36-1d164c047ca2",
+			"predicate": "http://www.ft.com/ontology/classification/isClassifiedBy",
+			"type":      "http://www.ft.com/ontology/person/Person",
+		},
+	}
+	videoUUID := "e2290d14-7e80-4db8-a715-949da4de9a07"
+
+	anns := vm.retrieveAnnotations(nextAnns, videoUUID)
+	anns = vm.canonicaliseConcepts(context.Background(), anns, videoUUID)
+	anns = vm.checkPredicateTypes(context.Background(), anns, videoUUID)
+
+	assert.Equal(t, []tag{
+		{"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "hasAuthor"},
+		{"http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740", "mentions"},
+		{"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "about"},
+		{"http://api.ft.com/things/e3e2b3b4-6b4a-4c4e-9e4c-6b0e4f3e6c1d", "hasAuthor"},
+	}, anns, "Annotations of concepts whose type is not allowed should be dropped, those of unknown type kept")
+	assert.Equal(t, []typeViolation{
+		{
+			Field:        "/annotations/1",
+			ConceptID:    "http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740",
+			Predicate:    "hasAuthor",
+			ConceptType:  "Organisation",
+			AllowedTypes: []string{"http://www.ft.com/ontology/person/Person"},
+		},
+		{
+			Field:        "/annotations/5",
+			ConceptID:    "http://api.ft.com/things/b43f1a91-b805-3453-8c36-1d164c047ca2",
+			Predicate:    "isClassifiedBy",
+			ConceptType:  "Person",
+			AllowedTypes: matrix["isClassifiedBy"],
+		},
+	}, vm.typeViolations, "The types of the canonical concepts should be checked")
+	assert.Equal(t, 2, vm.quality.Dropped[codeInvalidConceptType])
+	assert.ElementsMatch(t, []string{
+		"71a5efa5-e6e0-3ce1-9190-a7eac8bef325",
+		"d969d76e-f8f4-34ae-bc38-95cfd0884740",
+		"e3e2b3b4-6b4a-4c4e-9e4c-6b0e4f3e6c1d",
+	}, lookup.lookups, "Only the canonical concepts of constrained predicates without a type field should be looked up, once each")
+}
+
+func TestCheckPredicateTypesBoundsConcurrentLookups(t *testing.T) {
+	matrix, err := loadPredicateTypes("test-resources/predicate-types.json")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	lookup := conceptTypeLookupFunc(func(_ context.Context, _ string) (string, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight > maxInFlight {
+			maxInFlight = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return "http://www.ft.com/ontology/person/Person", nil
+	})
+	vm := videoMapper{
+		sc:           serviceConfig{predicateTypes: matrix, conceptTypeLookup: lookup},
+		conceptTypes: make(map[string]string),
+		quality:      newQualityReport("e2290d14-7e80-4db8-a715-949da4de9a07", 0),
+		log:          getLogger(),
+	}
+	var anns []tag
+	for i := 0; i < 3*conceptTypeLookupConcurrency; i++ {
+		anns = append(anns, tag{thingID: thingsURIPrefix + uuid.NewString(), predicate: "hasAuthor"})
+	}
+
+	assert.Equal(t, anns, vm.checkPredicateTypes(context.Background(), anns, "e2290d14-7e80-4db8-a715-949da4de9a07"))
+	assert.Len(t, vm.conceptTypes, len(anns))
+	assert.Greater(t, maxInFlight, 1, "The concept types should be looked up concurrently")
+	assert.LessOrEqual(t, maxInFlight, conceptTypeLookupConcurrency, "The concurrent lookups should be bounded")
+}
+
+// conceptTypeLookupFunc adapts a function to the conceptTypeLookup interface.
+type conceptTypeLookupFunc func(ctx context.Context, conceptUUID string) (string, error)
+
+func (f conceptTypeLookupFunc) conceptType(ctx context.Context, conceptUUID string) (string, error) {
+	return f(ctx, conceptUUID)
+}
+
+func TestMapRequestExplain(t *testing.T) {
+	matrix, err := loadPredicateTypes("test-resources/predicate-types.json")
+	require.NoError(t, err)
+	body := `{"id":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+		{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"http://www.ft.com/ontology/annotation/about"},
+		{"id":"http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740","predicate":"http://www.ft.com/ontology/annotation/hasAuthor",
+		 "type":"http://www.ft.com/ontology/organisation/Organisation"}]}`
+
+	sh := newServiceHandler(serviceConfig{predicateTypes: matrix}, getLogger())
+	req := httptest.NewRequest(http.MethodPost, "/map?explain=true", strings.NewReader(body))
+	req.Header.Set("X-Request-Id", "tid_explain")
+	w := httptest.NewRecorder()
+	sh.mapRequest(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var explanation mappingExplanation
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &explanation))
+	assert.JSONEq(t, `{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+		{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"about","relevanceScore":0.9,"confidenceScore":0.9}]}`,
+		string(explanation.ConceptAnnotation))
+	require.NotNil(t, explanation.Quality)
+	assert.Equal(t, 2, explanation.Quality.Inputs)
+	assert.Equal(t, 1, explanation.Quality.Accepted)
+	require.Len(t, explanation.TypeViolations, 1)
+	assert.Equal(t, "Organisation", explanation.TypeViolations[0].ConceptType)
+}
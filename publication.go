@@ -0,0 +1,110 @@
+package main
+
+import (
+	"time"
+)
+
+// Policies for the annotations of the videos not published yet.
+const (
+	publishUnpublished = "publish"
+	ignoreUnpublished  = "ignore"
+	holdUnpublished    = "hold"
+)
+
+// Decisions on publishing the annotations of a mapped video.
+const (
+	decisionPublished      = "published"
+	decisionDraftPublished = "draft_published"
+	decisionDraftIgnored   = "draft_ignored"
+	decisionDraftHeld      = "draft_held"
+	decisionReleased       = "released"
+	decisionDraftMissing   = "draft_missing"
+)
+
+const (
+	isPublishedField = "isPublished"
+	heldDraftsSize   = 10000
+	heldDraftsTTL    = 30 * 24 * time.Hour
+)
+
+func isUnpublishedPolicy(policy string) bool {
+	return policy == publishUnpublished || policy == ignoreUnpublished || policy == holdUnpublished
+}
+
+// publicationGate decides whether the annotations of a mapped video are published, according to the unpublished policy:
+// the annotations of the drafts are published like any other, ignored, or held back until the video is published.
+// The mapped message of the latest draft of each held video is kept, for its annotations to be released
+// when the video is published without annotations of its own. The held drafts are kept in memory only,
+// so a draft held before a restart or a rebalance can't be released.
+type publicationGate struct {
+	policy string
+	held   *lruCache
+}
+
+func newPublicationGate(policy string) *publicationGate {
+	g := &publicationGate{policy: policy}
+	if policy == holdUnpublished {
+		g.held = newLRUCache(heldDraftsSize, heldDraftsTTL)
+	}
+	return g
+}
+
+// decide returns the decision on the annotations of the video, which are published unless it is a draft ignored or held,
+// and the message to publish. That is the mapped message, with the annotations of the held draft
+// when a held video is published without annotations. A video published without annotations and without a held draft
+// is published as draft_missing, for its draft may have been lost. A nil publicationGate publishes the drafts.
+func (g *publicationGate) decide(videoUUID string, vm *videoMapper, m Message) (string, Message) {
+	if g == nil {
+		g = &publicationGate{policy: publishUnpublished}
+	}
+	published := vm.isPublished()
+	switch {
+	case published && g.held != nil:
+		draft, wasHeld := g.held.get(videoUUID)
+		if vm.isDeleteEvent() || (!wasHeld && vm.hasAnnotations()) {
+			return decisionPublished, m
+		}
+		if !wasHeld {
+			return decisionDraftMissing, m
+		}
+		if !vm.hasAnnotations() {
+			m.Body = draft.(string)
+		}
+		return decisionReleased, m
+	case published:
+		return decisionPublished, m
+	case g.policy == ignoreUnpublished:
+		return decisionDraftIgnored, m
+	case g.policy == holdUnpublished:
+		g.held.set(videoUUID, m.Body)
+		return decisionDraftHeld, m
+	default:
+		return decisionDraftPublished, m
+	}
+}
+
+// forget drops the draft held for the video, once the annotations of the video are published or deleted.
+func (g *publicationGate) forget(videoUUID string) {
+	if g != nil && g.held != nil {
+		g.held.delete(videoUUID)
+	}
+}
+
+func isPublishDecision(decision string) bool {
+	return decision == decisionPublished || decision == decisionDraftPublished || decision == decisionReleased ||
+		decision == decisionDraftMissing
+}
+
+// isPublished tells whether the video is published. Delete events and videos without the isPublished flag count as published.
+func (vm *videoMapper) isPublished() bool {
+	if vm.isDeleteEvent() {
+		return true
+	}
+	published, ok := vm.unmarshalled[isPublishedField].(bool)
+	return !ok || published
+}
+
+// hasAnnotations tells whether the Next video carries annotations, even an empty set of them.
+func (vm *videoMapper) hasAnnotations() bool {
+	return vm.unmarshalled[annotationsField] != nil
+}
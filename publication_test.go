@@ -0,0 +1,162 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublicationGateDecide(t *testing.T) {
+	const videoUUID = "e2290d14-7e80-4db8-a715-949da4de9a07"
+	draft := &videoMapper{unmarshalled: map[string]interface{}{isPublishedField: false, annotationsField: []interface{}{}}}
+	published := &videoMapper{unmarshalled: map[string]interface{}{isPublishedField: true, annotationsField: []interface{}{}}}
+	decide := func(g *publicationGate, vm *videoMapper) string {
+		decision, _ := g.decide(videoUUID, vm, Message{Body: "mapped"})
+		return decision
+	}
+
+	publish := newPublicationGate(publishUnpublished)
+	assert.Equal(t, decisionDraftPublished, decide(publish, draft))
+	assert.Equal(t, decisionPublished, decide(publish, published))
+
+	ignore := newPublicationGate(ignoreUnpublished)
+	assert.Equal(t, decisionDraftIgnored, decide(ignore, draft))
+	assert.Equal(t, decisionPublished, decide(ignore, published))
+
+	hold := newPublicationGate(holdUnpublished)
+	assert.Equal(t, decisionPublished, decide(hold, published), "A video never held should be published as usual")
+	assert.Equal(t, decisionDraftHeld, decide(hold, draft))
+	assert.Equal(t, decisionDraftHeld, decide(hold, draft))
+	assert.Equal(t, decisionReleased, decide(hold, published), "A held video should be released once it is published")
+	assert.Equal(t, decisionReleased, decide(hold, published), "A held video should be released until its annotations are published")
+	hold.forget(videoUUID)
+	assert.Equal(t, decisionPublished, decide(hold, published), "A released video should not be released again")
+
+	var unset *publicationGate
+	assert.Equal(t, decisionDraftPublished, decide(unset, draft))
+	unset.forget(videoUUID)
+
+	assert.True(t, isUnpublishedPolicy(holdUnpublished))
+	assert.False(t, isUnpublishedPolicy("drop"))
+}
+
+func TestPublicationGateReleasesTheHeldDraft(t *testing.T) {
+	const videoUUID = "e2290d14-7e80-4db8-a715-949da4de9a07"
+	draft := &videoMapper{unmarshalled: map[string]interface{}{isPublishedField: false, annotationsField: []interface{}{}}}
+	publishedWithAnnotations := &videoMapper{unmarshalled: map[string]interface{}{isPublishedField: true, annotationsField: []interface{}{}}}
+	publishedWithoutAnnotations := &videoMapper{unmarshalled: map[string]interface{}{isPublishedField: true}}
+	deleted := &videoMapper{unmarshalled: map[string]interface{}{deletedField: true}}
+	published := Message{Headers: map[string]string{"X-Request-Id": "tid_published"}, Body: "published"}
+
+	hold := newPublicationGate(holdUnpublished)
+	hold.decide(videoUUID, draft, Message{Body: "draft"})
+	_, m := hold.decide(videoUUID, publishedWithAnnotations, published)
+	assert.Equal(t, published, m, "The annotations of the published video should take precedence over those of the draft")
+
+	_, m = hold.decide(videoUUID, publishedWithoutAnnotations, published)
+	assert.Equal(t, "draft", m.Body, "The annotations of the draft should be released when the published video has none")
+	assert.Equal(t, "tid_published", m.Headers["X-Request-Id"])
+
+	decision, m := hold.decide(videoUUID, deleted, Message{Body: "deleted"})
+	assert.Equal(t, decisionPublished, decision, "A delete should not release the draft")
+	assert.Equal(t, "deleted", m.Body)
+	hold.forget(videoUUID)
+	decision, m = hold.decide(videoUUID, publishedWithoutAnnotations, published)
+	assert.Equal(t, decisionDraftMissing, decision, "A video published without annotations nor a held draft should be told apart")
+	assert.Equal(t, published, m, "A forgotten draft should not be released")
+	assert.True(t, isPublishDecision(decisionDraftMissing))
+
+	ignore := newPublicationGate(ignoreUnpublished)
+	ignore.decide(videoUUID, draft, Message{Body: "draft"})
+	_, m = ignore.decide(videoUUID, publishedWithoutAnnotations, published)
+	assert.Equal(t, published, m, "An ignored draft should not be released")
+}
+
+func TestVideoMapperIsPublished(t *testing.T) {
+	tests := []struct {
+		unmarshalled map[string]interface{}
+		expected     bool
+	}{
+		{map[string]interface{}{isPublishedField: true}, true},
+		{map[string]interface{}{isPublishedField: false}, false},
+		{map[string]interface{}{}, true},
+		{map[string]interface{}{isPublishedField: "false"}, true},
+		{map[string]interface{}{deletedField: true, isPublishedField: false}, true},
+	}
+
+	for _, test := range tests {
+		vm := videoMapper{unmarshalled: test.unmarshalled}
+		assert.Equal(t, test.expected, vm.isPublished(), "Published status is wrong for %v", test.unmarshalled)
+	}
+}
+
+func TestQueueConsumeUnpublishedPolicy(t *testing.T) {
+	draft := string(getBytes("next-video-input.json", t))
+	published := strings.Replace(draft, `"isPublished":false`, `"isPublished":true`, 1)
+	require.NotEqual(t, draft, published)
+
+	tests := []struct {
+		policy           string
+		body             string
+		expectedSent     bool
+		expectedDecision string
+	}{
+		{publishUnpublished, draft, true, decisionDraftPublished},
+		{ignoreUnpublished, draft, false, decisionDraftIgnored},
+		{holdUnpublished, draft, false, decisionDraftHeld},
+		{ignoreUnpublished, published, true, decisionPublished},
+	}
+
+	for _, test := range tests {
+		producer := mockMessageProducer{}
+		h := newQueueHandler(serviceConfig{unpublishedPolicy: test.policy}, &producer, getLogger())
+
+		before := testutil.ToFloat64(publicationDecisions.WithLabelValues(test.expectedDecision))
+		require.NoError(t, h.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, "tid_draft"), Body: test.body}))
+
+		assert.Equal(t, test.expectedSent, producer.sendCalled, "Sending is wrong for policy %s", test.policy)
+		assert.Equal(t, before+1, testutil.ToFloat64(publicationDecisions.WithLabelValues(test.expectedDecision)),
+			"Decision %s should be counted for policy %s", test.expectedDecision, test.policy)
+	}
+
+	producer := mockMessageProducer{}
+	h := newQueueHandler(serviceConfig{unpublishedPolicy: holdUnpublished}, &producer, getLogger())
+	require.NoError(t, h.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, "tid_draft"), Body: draft}))
+	assert.False(t, producer.sendCalled)
+	require.NoError(t, h.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, "tid_published"), Body: published}))
+	assert.True(t, producer.sendCalled, "The annotations should be published once the held video is published")
+	assert.Equal(t, "tid_published", producer.headers["X-Request-Id"])
+}
+
+func TestQueueConsumeReleasesTheHeldDraft(t *testing.T) {
+	draft := string(getBytes("next-video-input.json", t))
+	published := strings.Replace(draft, `"isPublished":false`, `"isPublished":true`, 1)
+	annotations := `"annotations":[{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"http://www.ft.com/ontology/classification/isClassifiedBy"}],`
+	publishedWithoutAnnotations := strings.Replace(published, annotations, "", 1)
+	require.NotEqual(t, published, publishedWithoutAnnotations)
+
+	sink := &recordingSink{}
+	h := newQueueHandler(serviceConfig{unpublishedPolicy: holdUnpublished}, sink, getLogger())
+	require.NoError(t, h.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, "tid_draft"), Body: draft}))
+	require.Empty(t, sink.sent())
+
+	sink.setFailing(true)
+	assert.Error(t, h.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, "tid_published"), Body: publishedWithoutAnnotations}))
+	sink.setFailing(false)
+	require.NoError(t, h.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, "tid_published"), Body: publishedWithoutAnnotations}))
+	require.Len(t, sink.sent(), 1, "The held draft should be kept until its annotations are published")
+	assert.Equal(t, "tid_published", sink.sent()[0].Headers["X-Request-Id"])
+	assert.JSONEq(t, `{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+		{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"isClassifiedBy","relevanceScore":0.9,"confidenceScore":0.9}]}`,
+		sink.sent()[0].Body, "The annotations of the held draft should be released")
+
+	before := testutil.ToFloat64(publicationDecisions.WithLabelValues(decisionDraftMissing))
+	require.NoError(t, h.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, "tid_republished"), Body: publishedWithoutAnnotations}))
+	assert.Equal(t, before+1, testutil.ToFloat64(publicationDecisions.WithLabelValues(decisionDraftMissing)),
+		"A release which could not happen should be counted")
+	assert.JSONEq(t, `{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[]}`, sink.sent()[1].Body,
+		"A released draft should not be released again")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	thingsURIPrefix      = "http://api.ft.com/things/"
+	qualityReportMsgType = "annotation-quality-report"
+	duplicateAnnotation  = "duplicate"
+)
+
+// Policies for the videos whose annotations were all invalid, leaving nothing to publish.
+const (
+	rejectEmptyAnnotations  = "reject"
+	publishEmptyAnnotations = "publish"
+)
+
+func isEmptyAnnotationsPolicy(policy string) bool {
+	return policy == rejectEmptyAnnotations || policy == publishEmptyAnnotations
+}
+
+// conceptIDPattern matches the concept IDs Next sends, which are either bare UUIDs or FT thing URIs in one of their variants.
+var conceptIDPattern = regexp.MustCompile(`^(?:(?:https?://)?(?:api|www)\.ft\.com/things?/)?([0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+
+// qualityReport summarises how the annotations of a Next video were mapped,
+// so that editorial tooling can flag poorly tagged videos.
+type qualityReport struct {
+	VideoUUID     string         `json:"uuid"`
+	Inputs        int            `json:"inputs"`
+	Accepted      int            `json:"accepted"`
+	Dropped       map[string]int `json:"dropped"`
+	Duplicates    int            `json:"duplicates"`
+	NormalisedIDs int            `json:"normalisedIds"`
+}
+
+func newQualityReport(videoUUID string, inputs int) *qualityReport {
+	return &qualityReport{
+		VideoUUID: videoUUID,
+		Inputs:    inputs,
+		Dropped:   make(map[string]int),
+	}
+}
+
+// drop records an annotation dropped because of the given mapping error.
+func (r *qualityReport) drop(me *mappingError) {
+	r.Dropped[me.Code]++
+}
+
+// duplicate records a duplicate annotation, telling whether it was dropped or kept.
+func (r *qualityReport) duplicate(dropped bool) {
+	r.Duplicates++
+	if dropped {
+		r.Dropped[duplicateAnnotation]++
+	}
+}
+
+// invalid returns the number of annotations dropped because of mapping errors, not counting the duplicates.
+func (r *qualityReport) invalid() int {
+	return r.Inputs - r.Accepted - r.Dropped[duplicateAnnotation]
+}
+
+// hasIssues tells whether any annotation of the video was dropped, repeated or sent with a variant concept ID.
+func (r *qualityReport) hasIssues() bool {
+	return r.Accepted < r.Inputs || r.Duplicates > 0 || r.NormalisedIDs > 0
+}
+
+func (r *qualityReport) logFields() map[string]interface{} {
+	return map[string]interface{}{
+		"annotation_quality": r,
+	}
+}
+
+// checkInvalidAnnotations rejects the video when the share of its invalid annotations is above maxInvalidPercent,
+// or when all of them were invalid and publishing an empty annotations set was not chosen.
+// A maxInvalidPercent of 0 disables the threshold. Videos sent without annotations are never rejected.
+func (r *qualityReport) checkInvalidAnnotations(maxInvalidPercent int, emptyPolicy string) *mappingError {
+	invalid := r.invalid()
+	if invalid == 0 {
+		return nil
+	}
+	if r.Accepted == 0 && emptyPolicy != publishEmptyAnnotations {
+		return newMappingError(codeInvalidAnnotations, fieldPath(annotationsField),
+			"all %d annotations of Next video %s are invalid, refusing to publish an empty annotations set", r.Inputs, r.VideoUUID)
+	}
+	if maxInvalidPercent > 0 && invalid*100 > maxInvalidPercent*r.Inputs {
+		return newMappingError(codeInvalidAnnotations, fieldPath(annotationsField),
+			"%d out of %d annotations of Next video %s are invalid, more than the %d%% allowed", invalid, r.Inputs, r.VideoUUID, maxInvalidPercent)
+	}
+	return nil
+}
+
+// newQualityReportMessage creates the message published on the quality topic for the given report.
+func newQualityReportMessage(r *qualityReport, tid string, origMsgHeaders map[string]string) (Message, error) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return Message{}, err
+	}
+	headers := map[string]string{
+		"X-Request-Id":      tid,
+		"Message-Timestamp": time.Now().Format(dateFormat),
+		"Message-Id":        uuid.New().String(),
+		"Message-Type":      qualityReportMsgType,
+		"Content-Type":      "application/json",
+		"Origin-System-Id":  origMsgHeaders["Origin-System-Id"],
+	}
+	return Message{Headers: headers, Body: string(body)}, nil
+}
+
+// normaliseConceptID rewrites the known variants of the concept IDs to the canonical thing URI
+// and tells whether the ID differs from it. Unrecognised IDs are only trimmed.
+func normaliseConceptID(id string) (string, bool) {
+	trimmed := strings.TrimSpace(id)
+	normalised := trimmed
+	if matches := conceptIDPattern.FindStringSubmatch(trimmed); matches != nil {
+		normalised = thingsURIPrefix + strings.ToLower(matches[1])
+	}
+	return normalised, normalised != id
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormaliseConceptID(t *testing.T) {
+	tests := []struct {
+		id                 string
+		expectedID         string
+		expectedNormalised bool
+	}{
+		{"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", false},
+		{"71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", true},
+		{"https://www.ft.com/thing/71A5EFA5-E6E0-3CE1-9190-A7EAC8BEF325", "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", true},
+		{" http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325 ", "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", true},
+		{"not-a-concept", "not-a-concept", false},
+		{" not-a-concept", "not-a-concept", true},
+	}
+
+	for _, test := range tests {
+		id, normalised := normaliseConceptID(test.id)
+		assert.Equal(t, test.expectedID, id, "Normalised ID is wrong. Input: %q", test.id)
+		assert.Equal(t, test.expectedNormalised, normalised, "Normalised flag is wrong. Input: %q", test.id)
+	}
+}
+
+func TestRetrieveAnnotationsQualityReport(t *testing.T) {
+	vm := videoMapper{sc: serviceConfig{normaliseConceptIDs: true}, log: getLogger()}
+	nextAnns := []map[string]interface{}{
+		newNextAnnotation("http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "http://www.ft.com/ontology/annotation/about"),
+		newNextAnnotation("71A5EFA5-E6E0-3CE1-9190-A7EAC8BEF325", "http://www.ft.com/ontology/annotation/about"),
+		newNextAnnotation("71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "http://www.ft.com/ontology/annotation/mentions"),
+		newNextAnnotation("http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740", "unknown_predicate_id"),
+		newNextAnnotation(nil, "http://www.ft.com/ontology/annotation/mentions"),
+		newNextAnnotation(1, "http://www.ft.com/ontology/annotation/mentions"),
+	}
+
+	anns := vm.retrieveAnnotations(nextAnns, "e2290d14-7e80-4db8-a715-949da4de9a07")
+
+	assert.Equal(t, []tag{
+		{"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "about"},
+		{"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "mentions"},
+	}, anns)
+	assert.Equal(t, &qualityReport{
+		VideoUUID: "e2290d14-7e80-4db8-a715-949da4de9a07",
+		Inputs:    6,
+		Accepted:  2,
+		Dropped: map[string]int{
+			duplicateAnnotation:  1,
+			codeUnknownPredicate: 1,
+			codeMissingField:     1,
+			codeWrongFieldType:   1,
+		},
+		Duplicates:    1,
+		NormalisedIDs: 2,
+	}, vm.quality)
+	assert.True(t, vm.quality.hasIssues())
+}
+
+func TestRetrieveAnnotationsOnlyReportsVariantIDs(t *testing.T) {
+	vm := videoMapper{log: getLogger()}
+	nextAnns := []map[string]interface{}{
+		newNextAnnotation("http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "http://www.ft.com/ontology/annotation/about"),
+		newNextAnnotation("71A5EFA5-E6E0-3CE1-9190-A7EAC8BEF325", "http://www.ft.com/ontology/annotation/about"),
+	}
+
+	anns := vm.retrieveAnnotations(nextAnns, "e2290d14-7e80-4db8-a715-949da4de9a07")
+
+	assert.Equal(t, []tag{
+		{"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "about"},
+		{"71A5EFA5-E6E0-3CE1-9190-A7EAC8BEF325", "about"},
+	}, anns, "The annotations should be kept as Next sent them")
+	assert.Equal(t, &qualityReport{
+		VideoUUID:     "e2290d14-7e80-4db8-a715-949da4de9a07",
+		Inputs:        2,
+		Accepted:      2,
+		Dropped:       map[string]int{},
+		Duplicates:    1,
+		NormalisedIDs: 1,
+	}, vm.quality)
+	assert.True(t, vm.quality.hasIssues())
+	assert.Nil(t, vm.quality.checkInvalidAnnotations(0, rejectEmptyAnnotations))
+}
+
+func TestQualityReportHasIssues(t *testing.T) {
+	report := newQualityReport("e2290d14-7e80-4db8-a715-949da4de9a07", 1)
+	report.Accepted = 1
+	assert.False(t, report.hasIssues())
+
+	report.NormalisedIDs = 1
+	assert.True(t, report.hasIssues(), "Normalised IDs should be reported as issues")
+}
+
+func TestCheckInvalidAnnotations(t *testing.T) {
+	tests := []struct {
+		inputs            int
+		accepted          int
+		duplicates        int
+		maxInvalidPercent int
+		emptyPolicy       string
+		expectedIsErr     bool
+	}{
+		{0, 0, 0, 0, rejectEmptyAnnotations, false},
+		{3, 3, 0, 10, rejectEmptyAnnotations, false},
+		{3, 0, 0, 0, rejectEmptyAnnotations, true},
+		{3, 0, 0, 0, publishEmptyAnnotations, false},
+		{3, 0, 0, 50, publishEmptyAnnotations, true},
+		{2, 1, 1, 0, rejectEmptyAnnotations, false},
+		{4, 2, 0, 50, rejectEmptyAnnotations, false},
+		{4, 1, 0, 50, rejectEmptyAnnotations, true},
+		{4, 1, 0, 0, rejectEmptyAnnotations, false},
+		{4, 1, 2, 50, rejectEmptyAnnotations, false},
+	}
+
+	for _, test := range tests {
+		report := newQualityReport("e2290d14-7e80-4db8-a715-949da4de9a07", test.inputs)
+		report.Accepted = test.accepted
+		report.Duplicates = test.duplicates
+		report.Dropped[duplicateAnnotation] = test.duplicates
+
+		err := report.checkInvalidAnnotations(test.maxInvalidPercent, test.emptyPolicy)
+		assert.Equal(t, test.expectedIsErr, err != nil, "Error status is wrong. Test: %+v", test)
+		if err != nil {
+			assert.Equal(t, codeInvalidAnnotations, err.Code)
+			assert.Equal(t, "/annotations", err.Field)
+		}
+	}
+}
+
+func TestNewQualityReportMessage(t *testing.T) {
+	report := newQualityReport("e2290d14-7e80-4db8-a715-949da4de9a07", 2)
+	report.Accepted = 1
+	report.drop(newMappingError(codeUnknownPredicate, "/annotations/1/predicate", "unknown"))
+
+	msg, err := newQualityReportMessage(report, "tid_1", createHeaders(nextVideoOrigin, "tid_1"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "tid_1", msg.Headers["X-Request-Id"])
+	assert.Equal(t, qualityReportMsgType, msg.Headers["Message-Type"])
+	assert.Equal(t, nextVideoOrigin, msg.Headers["Origin-System-Id"])
+	assert.NotEmpty(t, msg.Headers["Message-Id"])
+
+	var decoded qualityReport
+	require.NoError(t, json.Unmarshal([]byte(msg.Body), &decoded))
+	assert.Equal(t, *report, decoded)
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
-	"github.com/Financial-Times/kafka-client-go/v3"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -16,80 +17,239 @@ const (
 	generatedMsgType = "concept-annotations"
 	mapEvent         = "Map"
 	contentType      = "Annotations"
+
+	publicationDecisionField = "publication_decision"
 )
 
 type messageProducer interface {
-	SendMessage(kafka.FTMessage) error
+	SendMessage(Message) error
 }
 
 type queueHandler struct {
-	sc              serviceConfig
-	messageProducer messageProducer
-	log             *logger.UPPLogger
+	sc                 serviceConfig
+	messageProducer    messageProducer
+	deadLetterProducer messageProducer
+	qualityProducer    messageProducer
+	relatedProducer    messageProducer
+	publication        *publicationGate
+	log                *logger.UPPLogger
 }
 
 func newQueueHandler(sc serviceConfig, messageProducer messageProducer, log *logger.UPPLogger) *queueHandler {
 	return &queueHandler{
 		sc:              sc,
 		messageProducer: messageProducer,
+		publication:     newPublicationGate(sc.unpublishedPolicy),
 		log:             log,
 	}
 }
 
-func (h *queueHandler) queueConsume(m kafka.FTMessage) {
+// queueConsume maps the message and sends the result. It returns an error only when the message has to be consumed again:
+// when neither the mapped message, with its curated related content, nor, for a message which couldn't be mapped,
+// the dead-letter message could be sent.
+// Messages which are ignored, mapped and sent, or rejected are handled.
+func (h *queueHandler) queueConsume(m Message) error {
+	ctx, span := startSpan(extractTraceContext(context.Background(), propagation.MapCarrier(m.Headers)), "queueConsume",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messageAttributes(m)...),
+	)
+	defer span.End()
+
 	if m.Headers["Origin-System-Id"] != nextVideoOrigin {
+		consumedMessages.WithLabelValues(outcomeIgnored).Inc()
 		h.log.Infof("Ignoring message with different Origin-System-Id: %v", m.Headers["Origin-System-Id"])
-		return
+		return nil
 	}
-	vm := videoMapper{sc: h.sc, strContent: m.Body, tid: m.Headers["X-Request-Id"], log: h.log}
-	marshalledEvent, videoUUID, err := h.mapNextVideoAnnotationsMessage(&vm)
+	vm := videoMapper{sc: h.sc, strContent: m.Body, envelope: m.Headers[envelopeHeader], tid: m.Headers["X-Request-Id"], log: h.log}
+	marshalledEvent, videoUUID, err := h.mapNextVideoAnnotationsMessage(ctx, &vm)
+	span.SetAttributes(attribute.String("video_uuid", videoUUID))
 	if err != nil {
+		me := toMappingError(err)
+		recordSpanError(span, me)
+		recordMappingError(me)
 		h.log.WithMonitoringEvent(mapEvent, vm.tid, contentType).
 			WithValidFlag(false).
 			WithUUID(videoUUID).
 			WithError(err).
+			WithFields(me.logFields()).
 			Warnf("Error mapping the message from queue")
-		return
+		return h.deadLetter(ctx, m, vm.tid, me)
+	}
+
+	headers := createHeader(m.Headers, vm.tid, vm.syntheticTID)
+	if len(vm.ruleViolations) > 0 {
+		headers[ruleViolationsHeader] = ruleViolationsHeaderValue(vm.ruleViolations)
+	}
+	decision, msgToSend := h.publication.decide(videoUUID, &vm, Message{Headers: headers, Body: string(marshalledEvent)})
+	publicationDecisions.WithLabelValues(decision).Inc()
+	span.SetAttributes(attribute.String("publication_decision", decision))
+	if !isPublishDecision(decision) {
+		consumedMessages.WithLabelValues(outcomeIgnored).Inc()
+		h.log.WithMonitoringEvent(mapEvent, vm.tid, contentType).
+			WithValidFlag(true).
+			WithUUID(videoUUID).
+			WithField(publicationDecisionField, decision).
+			Info("Not publishing the annotations of the unpublished video.")
+		return nil
+	}
+	if decision == decisionDraftMissing {
+		h.log.WithTransactionID(vm.tid).
+			WithUUID(videoUUID).
+			WithField(publicationDecisionField, decision).
+			Warn("The video is published without annotations and no draft is held for it, the annotations of its draft may have been lost")
 	}
 
-	headers := createHeader(m.Headers)
-	msgToSend := string(marshalledEvent)
-	err = h.messageProducer.SendMessage(kafka.FTMessage{Headers: headers, Body: msgToSend})
+	err = h.sendOrHold(ctx, m, msgToSend, videoUUID, vm.isDeleteEvent())
 	if err != nil {
+		me := newMappingError(codeProduceFailed, "", "sending the mapped message failed: %v", err).withCause(err)
+		recordSpanError(span, me)
+		recordMappingError(me)
+		consumedMessages.WithLabelValues(outcomeFailed).Inc()
 		h.log.WithMonitoringEvent(mapEvent, vm.tid, contentType).
 			WithValidFlag(true).
 			WithUUID(videoUUID).
 			WithError(err).
+			WithFields(me.logFields()).
 			Warnf("Error sending transformed message to queue")
-		return
+		return err
 	}
+	h.publishRelatedContent(ctx, m, &vm, videoUUID)
+	h.publication.forget(videoUUID)
 
-	h.log.WithMonitoringEvent(mapEvent, vm.tid, contentType).
+	consumedMessages.WithLabelValues(outcomeMapped).Inc()
+	entry := h.log.WithMonitoringEvent(mapEvent, vm.tid, contentType).
 		WithValidFlag(true).
 		WithUUID(videoUUID).
-		Info("Mapped and sent.")
+		WithField(publicationDecisionField, decision)
+	if vm.quality == nil {
+		entry.Info("Mapped and sent.")
+		return nil
+	}
+	entry = entry.WithFields(vm.quality.logFields())
+	if vm.quality.hasIssues() {
+		entry.Warn("Mapped and sent with annotation quality issues.")
+	} else {
+		entry.Info("Mapped and sent.")
+	}
+	if !vm.isDeleteEvent() {
+		h.publishQualityReport(ctx, m, vm.tid, vm.quality)
+	}
+	return nil
 }
 
-func (h *queueHandler) mapNextVideoAnnotationsMessage(vm *videoMapper) ([]byte, string, error) {
+// publishQualityReport sends the annotation quality report of a mapped video to the quality sink, if one is configured.
+// The report is informative only, so failing to send it does not affect the mapping.
+func (h *queueHandler) publishQualityReport(ctx context.Context, m Message, tid string, report *qualityReport) {
+	if h.qualityProducer == nil {
+		return
+	}
+
+	_, span := startSpan(ctx, "publishQualityReport", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	msg, err := newQualityReportMessage(report, tid, m.Headers)
+	if err == nil {
+		injectTraceContext(ctx, msg.Headers)
+		err = h.qualityProducer.SendMessage(msg)
+	}
+	if err != nil {
+		recordSpanError(span, err)
+		h.log.WithTransactionID(tid).
+			WithUUID(report.VideoUUID).
+			WithError(err).
+			Error("Error sending the annotation quality report")
+	}
+}
+
+// sendOrHold sends the mapped message, unless the producer coalesces the messages of a video,
+// in which case a publish is held and a delete is sent straight away after any message held for the video.
+// The result of a held publish is handed over to the source of the consumed message, so that the message is only
+// committed once the publish is sent or replaced by a newer one. A source which can't take it waits for it instead.
+func (h *queueHandler) sendOrHold(ctx context.Context, consumed Message, m Message, videoUUID string, deleteEvent bool) error {
+	cp, ok := h.messageProducer.(coalescingProducer)
+	if !ok {
+		return h.sendMessage(ctx, m)
+	}
+	if !deleteEvent {
+		injectTraceContext(ctx, m.Headers)
+		sent := cp.hold(videoUUID, m)
+		if consumed.settleLater(sent) {
+			return nil
+		}
+		return <-sent
+	}
+	if err := cp.flush(videoUUID); err != nil {
+		return err
+	}
+	return h.sendMessage(ctx, m)
+}
+
+func (h *queueHandler) sendMessage(ctx context.Context, m Message) error {
+	ctx, span := startSpan(ctx, "sendMessage", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	injectTraceContext(ctx, m.Headers)
+	err := h.messageProducer.SendMessage(m)
+	recordSpanError(span, err)
+	return err
+}
+
+// deadLetter sends the message that could not be mapped to the dead-letter sink, if one is configured.
+// Without a dead-letter sink the message is rejected, only being logged.
+func (h *queueHandler) deadLetter(ctx context.Context, m Message, tid string, me *mappingError) error {
+	if h.deadLetterProducer == nil {
+		consumedMessages.WithLabelValues(outcomeRejected).Inc()
+		return nil
+	}
+
+	if err := h.sendDeadLetter(ctx, newDeadLetterMessage(m, me), tid, me); err != nil {
+		return err
+	}
+	consumedMessages.WithLabelValues(outcomeDeadLettered).Inc()
+	return nil
+}
+
+func (h *queueHandler) sendDeadLetter(ctx context.Context, dlm Message, tid string, me *mappingError) error {
+	_, span := startSpan(ctx, "deadLetter", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	injectTraceContext(ctx, dlm.Headers)
+	if err := h.deadLetterProducer.SendMessage(dlm); err != nil {
+		recordSpanError(span, err)
+		consumedMessages.WithLabelValues(outcomeFailed).Inc()
+		h.log.WithTransactionID(tid).
+			WithError(err).
+			WithFields(me.logFields()).
+			Error("Error sending the message to the dead-letter queue")
+		return err
+	}
+	return nil
+}
+
+func (h *queueHandler) mapNextVideoAnnotationsMessage(ctx context.Context, vm *videoMapper) ([]byte, string, error) {
 	h.log.WithTransactionID(vm.tid).
 		Info("Start mapping next video message.")
 
-	if err := json.Unmarshal([]byte(vm.strContent), &vm.unmarshalled); err != nil {
-		return nil, "", fmt.Errorf("video JSON from Next couldn't be unmarshalled: %v. Skipping invalid JSON with tid: %s", err, vm.tid)
+	if err := vm.unmarshal(ctx); err != nil {
+		return nil, "", err
 	}
-	if vm.tid == "" {
-		return nil, "", fmt.Errorf("X-Request-Id not found in kafka message headers. Skipping message with tid %s", vm.tid)
+	if err := vm.resolveTransactionID(rejectMissingTID); err != nil {
+		return nil, "", err
 	}
-	return vm.mapNextVideoAnnotations()
+	return vm.mapNextVideoAnnotations(ctx)
 }
 
-func createHeader(origMsgHeaders map[string]string) map[string]string {
-	return map[string]string{
-		"X-Request-Id":      origMsgHeaders["X-Request-Id"],
+func createHeader(origMsgHeaders map[string]string, tid string, syntheticTID bool) map[string]string {
+	headers := map[string]string{
+		"X-Request-Id":      tid,
 		"Message-Timestamp": time.Now().Format(dateFormat),
 		"Message-Id":        uuid.New().String(),
 		"Message-Type":      generatedMsgType,
 		"Content-Type":      "application/json",
 		"Origin-System-Id":  origMsgHeaders["Origin-System-Id"],
 	}
+	if syntheticTID {
+		headers[syntheticTIDHeader] = "true"
+	}
+	return headers
 }
@@ -1,15 +1,20 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"strings"
 	"testing"
 
-	"github.com/Financial-Times/kafka-client-go/v3"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockMessageProducer struct {
 	message    string
+	headers    map[string]string
 	sendCalled bool
 }
 
@@ -27,7 +32,7 @@ func TestQueueConsume(t *testing.T) {
 			"1234",
 			true,
 			newStringConceptAnnotation(t, "e2290d14-7e80-4db8-a715-949da4de9a07",
-				[]annotation{{"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "isClassifiedBy", defaultRelevanceScore, defaultConfidenceScore}},
+				[]annotation{{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "isClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}},
 			),
 		},
 		{
@@ -76,7 +81,7 @@ func TestQueueConsume(t *testing.T) {
 			log:             getLogger(),
 		}
 
-		msg := kafka.FTMessage{
+		msg := Message{
 			Headers: createHeaders(test.originSystem, test.tid),
 			Body:    string(getBytes(test.fileName, t)),
 		}
@@ -89,6 +94,142 @@ func TestQueueConsume(t *testing.T) {
 	}
 }
 
+func TestQueueConsumeMissingTID(t *testing.T) {
+	tests := []struct {
+		policy            string
+		expectedMsgSent   bool
+		expectedSynthetic string
+	}{
+		{"", false, ""},
+		{rejectMissingTID, false, ""},
+		{generateMissingTID, true, "true"},
+	}
+
+	for _, test := range tests {
+		mockMsgProducer := mockMessageProducer{}
+		h := newQueueHandler(serviceConfig{missingTIDPolicy: test.policy}, &mockMsgProducer, getLogger())
+
+		h.queueConsume(Message{
+			Headers: createHeaders(nextVideoOrigin, ""),
+			Body:    string(getBytes("next-video-input.json", t)),
+		})
+
+		assert.Equal(t, test.expectedMsgSent, mockMsgProducer.sendCalled, "Message sending check is wrong. Policy: %s", test.policy)
+		assert.Equal(t, test.expectedSynthetic, mockMsgProducer.headers[syntheticTIDHeader], "Synthetic tid header wrong. Policy: %s", test.policy)
+		if test.expectedMsgSent {
+			assert.True(t, strings.HasPrefix(mockMsgProducer.headers["X-Request-Id"], transactionIDPrefix), "Generated tid should be sent. Policy: %s", test.policy)
+		}
+	}
+}
+
+func TestQueueConsumeDeadLetter(t *testing.T) {
+	tests := []struct {
+		fileName           string
+		expectedDeadLetter bool
+		expectedCode       string
+		expectedField      string
+	}{
+		{"next-video-input.json", false, "", ""},
+		{"invalid-format.json", true, codeInvalidJSON, ""},
+		{"next-video-no-videouuid-input.json", true, codeMissingField, "/id"},
+		{"golden/all-annotations-invalid.input.json", true, codeInvalidAnnotations, "/annotations"},
+	}
+
+	for _, test := range tests {
+		producer := mockMessageProducer{}
+		deadLetter := mockMessageProducer{}
+		h := newQueueHandler(serviceConfig{}, &producer, getLogger())
+		h.deadLetterProducer = &deadLetter
+
+		before := testutil.ToFloat64(consumedMessages.WithLabelValues(outcomeDeadLettered))
+		h.queueConsume(Message{
+			Headers: createHeaders(nextVideoOrigin, "tid_dead_letter"),
+			Body:    string(getBytes(test.fileName, t)),
+		})
+
+		assert.Equal(t, !test.expectedDeadLetter, producer.sendCalled, "Message sending check is wrong. Input JSON: %s", test.fileName)
+		assert.Equal(t, test.expectedDeadLetter, deadLetter.sendCalled, "Dead-letter check is wrong. Input JSON: %s", test.fileName)
+		if !test.expectedDeadLetter {
+			continue
+		}
+		assert.Equal(t, string(getBytes(test.fileName, t)), deadLetter.message, "The original body should be dead-lettered. Input JSON: %s", test.fileName)
+		assert.Equal(t, "tid_dead_letter", deadLetter.headers["X-Request-Id"])
+		assert.Equal(t, test.expectedCode, deadLetter.headers[errorCodeHeader], "Error code is wrong. Input JSON: %s", test.fileName)
+		assert.Equal(t, test.expectedField, deadLetter.headers[errorFieldHeader], "Error field is wrong. Input JSON: %s", test.fileName)
+		assert.Equal(t, before+1, testutil.ToFloat64(consumedMessages.WithLabelValues(outcomeDeadLettered)))
+	}
+}
+
+func TestQueueConsumeQualityReport(t *testing.T) {
+	tests := []struct {
+		fileName          string
+		expectedPublished bool
+		expectedInputs    int
+		expectedAccepted  int
+	}{
+		{"next-video-input.json", true, 1, 1},
+		{"golden/invalid-annotation-entries.input.json", true, 4, 1},
+		{"next-video-delete-input.json", false, 0, 0},
+		{"invalid-format.json", false, 0, 0},
+	}
+
+	for _, test := range tests {
+		producer := mockMessageProducer{}
+		quality := mockMessageProducer{}
+		h := newQueueHandler(serviceConfig{}, &producer, getLogger())
+		h.qualityProducer = &quality
+
+		h.queueConsume(Message{
+			Headers: createHeaders(nextVideoOrigin, "tid_quality"),
+			Body:    string(getBytes(test.fileName, t)),
+		})
+
+		assert.Equal(t, test.expectedPublished, quality.sendCalled, "Quality report check is wrong. Input JSON: %s", test.fileName)
+		if !test.expectedPublished {
+			continue
+		}
+		var report qualityReport
+		require.NoError(t, json.Unmarshal([]byte(quality.message), &report))
+		assert.Equal(t, "e2290d14-7e80-4db8-a715-949da4de9a07", report.VideoUUID)
+		assert.Equal(t, test.expectedInputs, report.Inputs, "Inputs are wrong. Input JSON: %s", test.fileName)
+		assert.Equal(t, test.expectedAccepted, report.Accepted, "Accepted annotations are wrong. Input JSON: %s", test.fileName)
+		assert.Equal(t, "tid_quality", quality.headers["X-Request-Id"])
+		assert.Equal(t, qualityReportMsgType, quality.headers["Message-Type"])
+	}
+}
+
+func TestQueueConsumeReportsUnhandledMessages(t *testing.T) {
+	tests := []struct {
+		fileName        string
+		producer        messageProducer
+		deadLetter      messageProducer
+		expectedHandled bool
+	}{
+		{"next-video-input.json", &mockMessageProducer{}, nil, true},
+		{"next-video-input.json", &failingMessageProducer{}, nil, false},
+		{"invalid-format.json", &mockMessageProducer{}, nil, true},
+		{"invalid-format.json", &mockMessageProducer{}, &mockMessageProducer{}, true},
+		{"invalid-format.json", &mockMessageProducer{}, &failingMessageProducer{}, false},
+	}
+
+	for _, test := range tests {
+		h := newQueueHandler(serviceConfig{}, test.producer, getLogger())
+		h.deadLetterProducer = test.deadLetter
+
+		err := h.queueConsume(Message{
+			Headers: createHeaders(nextVideoOrigin, "tid_handled"),
+			Body:    string(getBytes(test.fileName, t)),
+		})
+		assert.Equal(t, test.expectedHandled, err == nil, "Handled status is wrong. Input JSON: %s, producer: %T, dead-letter: %T", test.fileName, test.producer, test.deadLetter)
+	}
+}
+
+type failingMessageProducer struct{}
+
+func (failingMessageProducer) SendMessage(Message) error {
+	return errors.New("producer is unavailable")
+}
+
 func createHeaders(originSystem string, requestID string) map[string]string {
 	var result = make(map[string]string)
 	result["Origin-System-Id"] = originSystem
@@ -96,8 +237,9 @@ func createHeaders(originSystem string, requestID string) map[string]string {
 	return result
 }
 
-func (mock *mockMessageProducer) SendMessage(message kafka.FTMessage) error {
+func (mock *mockMessageProducer) SendMessage(message Message) error {
 	mock.message = message.Body
+	mock.headers = message.Headers
 	mock.sendCalled = true
 	return nil
 }
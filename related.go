@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	relatedField          = "related"
+	relatedItemIDField    = "id"
+	relatedContentMsgType = "curated-related-content"
+)
+
+// relatedContent is the curated related content of a video, listing the related content in the order chosen by the editor.
+type relatedContent struct {
+	UUID  string        `json:"uuid"`
+	Items []relatedItem `json:"items"`
+}
+
+type relatedItem struct {
+	UUID string `json:"uuid"`
+}
+
+// relatedContent extracts the related content of the video from the items of its related array, which are objects
+// with the UUID of the content as id, or plain UUIDs. Items without a valid UUID and repeated items are skipped,
+// keeping the order of the others. It returns false for a publish event without a related array, which leaves
+// the related content unchanged, while a delete event clears it.
+func (vm *videoMapper) relatedContent(videoUUID string) (relatedContent, bool) {
+	rc := relatedContent{UUID: videoUUID, Items: make([]relatedItem, 0)}
+	if vm.isDeleteEvent() {
+		return rc, true
+	}
+	related, ok := vm.unmarshalled[relatedField].([]interface{})
+	if !ok {
+		return rc, false
+	}
+
+	seen := make(map[string]bool)
+	for i, item := range related {
+		id, _ := item.(string)
+		if obj, isObject := item.(map[string]interface{}); isObject {
+			id, _ = obj[relatedItemIDField].(string)
+		}
+		parsed, err := uuid.Parse(id)
+		if err != nil {
+			vm.log.WithTransactionID(vm.tid).
+				WithUUID(videoUUID).
+				WithField("field", fieldPath(relatedField, i)).
+				Warnf("Skipping related item without a valid content UUID: %v", item)
+			continue
+		}
+		if seen[parsed.String()] {
+			continue
+		}
+		seen[parsed.String()] = true
+		rc.Items = append(rc.Items, relatedItem{UUID: parsed.String()})
+	}
+	return rc, true
+}
+
+func newRelatedContentMessage(rc relatedContent, tid string, origMsgHeaders map[string]string) (Message, error) {
+	body, err := json.Marshal(rc)
+	if err != nil {
+		return Message{}, err
+	}
+	headers := map[string]string{
+		"X-Request-Id":      tid,
+		"Message-Timestamp": time.Now().Format(dateFormat),
+		"Message-Id":        uuid.New().String(),
+		"Message-Type":      relatedContentMsgType,
+		"Content-Type":      "application/json",
+		"Origin-System-Id":  origMsgHeaders["Origin-System-Id"],
+	}
+	return Message{Headers: headers, Body: string(body)}, nil
+}
+
+// publishRelatedContent sends the curated related content of a mapped video to the related content sink, if one is configured.
+// The annotations of the video are already sent by then, so failing to send it is logged and counted without failing the message.
+func (h *queueHandler) publishRelatedContent(ctx context.Context, m Message, vm *videoMapper, videoUUID string) {
+	if h.relatedProducer == nil {
+		return
+	}
+	rc, ok := vm.relatedContent(videoUUID)
+	if !ok {
+		return
+	}
+
+	_, span := startSpan(ctx, "publishRelatedContent", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	msg, err := newRelatedContentMessage(rc, vm.tid, m.Headers)
+	if err == nil {
+		injectTraceContext(ctx, msg.Headers)
+		err = h.relatedProducer.SendMessage(msg)
+	}
+	if err != nil {
+		recordSpanError(span, err)
+		relatedContentFailures.Inc()
+		h.log.WithTransactionID(vm.tid).
+			WithUUID(videoUUID).
+			WithError(err).
+			Error("Error sending the curated related content")
+	}
+}
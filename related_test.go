@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVideoMapperRelatedContent(t *testing.T) {
+	const videoUUID = "e2290d14-7e80-4db8-a715-949da4de9a07"
+
+	tests := []struct {
+		name          string
+		video         string
+		expectedItems []relatedItem
+		expectedOK    bool
+	}{
+		{
+			"items in the editor's order",
+			`{"related": [{"id": "c4cde316-128c-11e7-80f4-13e067d5072c"}, {"id": "0B8B5CA4-6E2C-11E7-B7F4-7F0D1AFBEC6B"}, "9a8e6f92-2f71-11e7-9555-23ef563ecf9a"]}`,
+			[]relatedItem{{"c4cde316-128c-11e7-80f4-13e067d5072c"}, {"0b8b5ca4-6e2c-11e7-b7f4-7f0d1afbec6b"}, {"9a8e6f92-2f71-11e7-9555-23ef563ecf9a"}},
+			true,
+		},
+		{
+			"invalid and repeated items skipped",
+			`{"related": [{"id": "not-a-uuid"}, {"title": "no id"}, 42, {"id": "c4cde316-128c-11e7-80f4-13e067d5072c"}, {"id": "C4CDE316-128C-11E7-80F4-13E067D5072C"}]}`,
+			[]relatedItem{{"c4cde316-128c-11e7-80f4-13e067d5072c"}},
+			true,
+		},
+		{"empty related", `{"related": []}`, []relatedItem{}, true},
+		{"no related", `{"id": "` + videoUUID + `"}`, []relatedItem{}, false},
+		{"related not an array", `{"related": "c4cde316-128c-11e7-80f4-13e067d5072c"}`, []relatedItem{}, false},
+		{"delete clears the related content", `{"uuid": "` + videoUUID + `", "deleted": true}`, []relatedItem{}, true},
+	}
+
+	for _, test := range tests {
+		vm := videoMapper{log: getLogger()}
+		require.NoError(t, json.Unmarshal([]byte(test.video), &vm.unmarshalled), test.name)
+
+		rc, ok := vm.relatedContent(videoUUID)
+		assert.Equal(t, test.expectedOK, ok, test.name)
+		assert.Equal(t, videoUUID, rc.UUID, test.name)
+		assert.Equal(t, test.expectedItems, rc.Items, test.name)
+	}
+}
+
+func TestQueueConsumeRelatedContent(t *testing.T) {
+	producer := mockMessageProducer{}
+	related := mockMessageProducer{}
+	h := newQueueHandler(serviceConfig{}, &producer, getLogger())
+	h.relatedProducer = &related
+
+	require.NoError(t, h.queueConsume(Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_related"),
+		Body:    string(getBytes("next-video-input.json", t)),
+	}))
+	assert.True(t, producer.sendCalled)
+	require.True(t, related.sendCalled, "The curated related content should be sent")
+	assert.JSONEq(t, `{"uuid": "e2290d14-7e80-4db8-a715-949da4de9a07", "items": [{"uuid": "c4cde316-128c-11e7-80f4-13e067d5072c"}]}`, related.message)
+	assert.Equal(t, relatedContentMsgType, related.headers["Message-Type"])
+	assert.Equal(t, "tid_related", related.headers["X-Request-Id"])
+	assert.Equal(t, nextVideoOrigin, related.headers["Origin-System-Id"])
+
+	related = mockMessageProducer{}
+	require.NoError(t, h.queueConsume(Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_related_delete"),
+		Body:    string(getBytes("next-video-delete-input.json", t)),
+	}))
+	assert.JSONEq(t, `{"uuid": "e2290d14-7e80-4db8-a715-949da4de9a07", "items": []}`, related.message, "A delete should clear the related content")
+
+	h.relatedProducer = failingMessageProducer{}
+	before := testutil.ToFloat64(relatedContentFailures)
+	err := h.queueConsume(Message{
+		Headers: createHeaders(nextVideoOrigin, "tid_related_failing"),
+		Body:    string(getBytes("next-video-input.json", t)),
+	})
+	assert.NoError(t, err, "The message should not be consumed again when only its related content can't be sent")
+	assert.Equal(t, before+1, testutil.ToFloat64(relatedContentFailures))
+}
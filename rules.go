@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	annotationTypeField  = "type"
+	ruleViolationsHeader = "X-Annotation-Rule-Violations"
+)
+
+// Kinds of the annotation rules.
+const (
+	maxCountRule     = "maxCount"
+	minCountRule     = "minCount"
+	conceptTypesRule = "conceptTypes"
+)
+
+// annotationRule is a business rule checked on the annotations of a video after they are mapped.
+// A violation of a warning rule is only reported in the headers of the mapped message,
+// while a violation of an error rule rejects the video.
+//   - maxCount: at most Count annotations with any of the Predicates;
+//   - minCount: at least Count annotations with any of the Predicates;
+//   - conceptTypes: the annotations with any of the Predicates point to concepts of one of the Types,
+//     checked only for the concepts whose type is known.
+type annotationRule struct {
+	Name       string   `json:"name"`
+	Kind       string   `json:"rule"`
+	Predicates []string `json:"predicates"`
+	Count      int      `json:"count,omitempty"`
+	Types      []string `json:"types,omitempty"`
+	Severity   string   `json:"severity"`
+}
+
+type ruleViolation struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// loadAnnotationRules reads the annotation rules from a JSON file. An empty path means no rules.
+func loadAnnotationRules(path string) ([]annotationRule, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []annotationRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("annotation rules in %s are not valid JSON: %w", path, err)
+	}
+	for _, rule := range rules {
+		if err := rule.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+func (r annotationRule) validate() error {
+	switch r.Kind {
+	case maxCountRule, minCountRule:
+		if r.Count < 0 {
+			return fmt.Errorf("annotation rule %q has a negative count", r.Name)
+		}
+	case conceptTypesRule:
+		if len(r.Types) == 0 {
+			return fmt.Errorf("annotation rule %q has no concept types", r.Name)
+		}
+	default:
+		return fmt.Errorf("annotation rule %q is of unknown kind %q", r.Name, r.Kind)
+	}
+	if r.Name == "" {
+		return fmt.Errorf("annotation rule of kind %q has no name", r.Kind)
+	}
+	if len(r.Predicates) == 0 {
+		return fmt.Errorf("annotation rule %q has no predicates", r.Name)
+	}
+	for _, predicate := range r.Predicates {
+		if _, known := shortPredicates[predicate]; !known {
+			return fmt.Errorf("annotation rule %q uses unknown predicate %q", r.Name, predicate)
+		}
+	}
+	if r.Severity != severityWarning && r.Severity != severityError {
+		return fmt.Errorf("annotation rule %q has severity %q, expected %s or %s", r.Name, r.Severity, severityWarning, severityError)
+	}
+	return nil
+}
+
+// check returns the violation of the rule by the annotations, if any.
+// conceptTypes holds the known types of the annotated concepts by their ID.
+func (r annotationRule) check(annotations []tag, conceptTypes map[string]string) *ruleViolation {
+	var matching []tag
+	for _, ann := range annotations {
+		if r.hasPredicate(ann.predicate) {
+			matching = append(matching, ann)
+		}
+	}
+
+	switch r.Kind {
+	case maxCountRule:
+		if len(matching) > r.Count {
+			return r.violation("%d annotations with predicate %s, at most %d allowed", len(matching), strings.Join(r.Predicates, " or "), r.Count)
+		}
+	case minCountRule:
+		if len(matching) < r.Count {
+			return r.violation("%d annotations with predicate %s, at least %d required", len(matching), strings.Join(r.Predicates, " or "), r.Count)
+		}
+	case conceptTypesRule:
+		for _, ann := range matching {
+			conceptType, known := conceptTypes[ann.thingID]
+			if known && !r.hasType(conceptType) {
+				return r.violation("%s annotation points to %s of type %s, expected %s", ann.predicate, ann.thingID, conceptType, strings.Join(r.Types, " or "))
+			}
+		}
+	}
+	return nil
+}
+
+func (r annotationRule) hasPredicate(predicate string) bool {
+	for _, p := range r.Predicates {
+		if p == predicate {
+			return true
+		}
+	}
+	return false
+}
+
+func (r annotationRule) hasType(conceptType string) bool {
+	for _, t := range r.Types {
+		if conceptTypeShortForm(t) == conceptType {
+			return true
+		}
+	}
+	return false
+}
+
+func (r annotationRule) violation(format string, args ...interface{}) *ruleViolation {
+	return &ruleViolation{Rule: r.Name, Severity: r.Severity, Message: fmt.Sprintf(format, args...)}
+}
+
+// conceptTypeShortForm strips the ontology namespace from a concept type, e.g. http://www.ft.com/ontology/person/Person becomes Person.
+func conceptTypeShortForm(conceptType string) string {
+	return conceptType[strings.LastIndex(conceptType, "/")+1:]
+}
+
+// checkAnnotationRules applies the configured rules to the annotations to be published, including the derived ones.
+// The rules are not applied to delete events, which carry no annotations.
+// The warning violations are kept on the videoMapper to be reported with the mapped message,
+// while any error violation is returned as a mappingError rejecting the video.
+func (vm *videoMapper) checkAnnotationRules(annotations []annotation, videoUUID string) error {
+	if len(vm.sc.annotationRules) == 0 || vm.isDeleteEvent() {
+		return nil
+	}
+	tags := make([]tag, 0, len(annotations))
+	for _, ann := range annotations {
+		tags = append(tags, tag{thingID: ann.ID, predicate: ann.Predicate})
+	}
+
+	var errorMessages []string
+	for _, rule := range vm.sc.annotationRules {
+		v := rule.check(tags, vm.conceptTypes)
+		if v == nil {
+			continue
+		}
+		recordRuleViolation(v)
+		vm.log.WithTransactionID(vm.tid).
+			WithUUID(videoUUID).
+			WithFields(map[string]interface{}{"rule": v.Rule, "rule_severity": v.Severity}).
+			Warnf("Annotation rule violated: %s", v.Message)
+		if v.Severity == severityError {
+			errorMessages = append(errorMessages, v.Rule+": "+v.Message)
+			continue
+		}
+		vm.ruleViolations = append(vm.ruleViolations, *v)
+	}
+
+	if len(errorMessages) > 0 {
+		return newMappingError(codeRuleViolation, fieldPath(annotationsField), "annotations of Next video %s violate the rules: %s", videoUUID, strings.Join(errorMessages, "; "))
+	}
+	return nil
+}
+
+// ruleViolationsHeaderValue lists the names of the violated warning rules, in a stable order.
+func ruleViolationsHeaderValue(violations []ruleViolation) string {
+	names := make([]string, 0, len(violations))
+	for _, v := range violations {
+		names = append(names, v.Rule)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadAnnotationRules(t *testing.T) {
+	rules, err := loadAnnotationRules("test-resources/annotation-rules.json")
+	require.NoError(t, err)
+	assert.Len(t, rules, 3)
+
+	rules, err = loadAnnotationRules("")
+	assert.NoError(t, err)
+	assert.Empty(t, rules)
+
+	_, err = loadAnnotationRules("test-resources/missing-rules.json")
+	assert.Error(t, err)
+}
+
+func TestLoadInvalidAnnotationRules(t *testing.T) {
+	tests := []string{
+		`not json`,
+		`[{"name":"r","rule":"unknownKind","predicates":["about"],"severity":"error"}]`,
+		`[{"rule":"minCount","predicates":["about"],"count":1,"severity":"error"}]`,
+		`[{"name":"r","rule":"minCount","predicates":[],"count":1,"severity":"error"}]`,
+		`[{"name":"r","rule":"minCount","predicates":["unknownPredicate"],"count":1,"severity":"error"}]`,
+		`[{"name":"r","rule":"maxCount","predicates":["about"],"count":-1,"severity":"error"}]`,
+		`[{"name":"r","rule":"conceptTypes","predicates":["hasAuthor"],"severity":"error"}]`,
+		`[{"name":"r","rule":"minCount","predicates":["about"],"count":1,"severity":"critical"}]`,
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(t.TempDir(), "rules.json")
+		require.NoError(t, os.WriteFile(path, []byte(test), 0644))
+		_, err := loadAnnotationRules(path)
+		assert.Error(t, err, "Rules should be rejected: %s", test)
+	}
+}
+
+func TestAnnotationRuleCheck(t *testing.T) {
+	maxPrimary := annotationRule{Name: "max", Kind: maxCountRule, Predicates: []string{"isPrimarilyClassifiedBy"}, Count: 1, Severity: severityError}
+	minAbout := annotationRule{Name: "min", Kind: minCountRule, Predicates: []string{"about", "isClassifiedBy"}, Count: 1, Severity: severityWarning}
+	authorIsPerson := annotationRule{Name: "author", Kind: conceptTypesRule, Predicates: []string{"hasAuthor"}, Types: []string{"http://www.ft.com/ontology/person/Person"}, Severity: severityError}
+	conceptTypes := map[string]string{"thing1": "Person", "thing2": "Organisation"}
+
+	tests := []struct {
+		rule              annotationRule
+		annotations       []tag
+		expectedViolation bool
+	}{
+		{maxPrimary, []tag{{"thing1", "isPrimarilyClassifiedBy"}}, false},
+		{maxPrimary, []tag{{"thing1", "isPrimarilyClassifiedBy"}, {"thing2", "isPrimarilyClassifiedBy"}}, true},
+		{minAbout, []tag{{"thing1", "isClassifiedBy"}}, false},
+		{minAbout, []tag{{"thing1", "mentions"}}, true},
+		{minAbout, []tag{}, true},
+		{authorIsPerson, []tag{{"thing1", "hasAuthor"}}, false},
+		{authorIsPerson, []tag{{"thing2", "hasAuthor"}}, true},
+		{authorIsPerson, []tag{{"thing3", "hasAuthor"}}, false},
+		{authorIsPerson, []tag{{"thing2", "mentions"}}, false},
+	}
+
+	for _, test := range tests {
+		v := test.rule.check(test.annotations, conceptTypes)
+		assert.Equal(t, test.expectedViolation, v != nil, "Violation is wrong. Rule: %s, annotations: %v", test.rule.Name, test.annotations)
+		if v != nil {
+			assert.Equal(t, test.rule.Name, v.Rule)
+			assert.Equal(t, test.rule.Severity, v.Severity)
+		}
+	}
+}
+
+func TestAnnotationRulesOutcome(t *testing.T) {
+	rules, err := loadAnnotationRules("test-resources/annotation-rules.json")
+	require.NoError(t, err)
+	sc := serviceConfig{annotationRules: rules}
+
+	tests := []struct {
+		annotations        string
+		expectedMapped     bool
+		expectedViolations string
+		expectedStatus     int
+	}{
+		{
+			`[{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"http://www.ft.com/ontology/annotation/about"}]`,
+			true, "", http.StatusOK,
+		},
+		{
+			`[{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"http://www.ft.com/ontology/annotation/mentions"}]`,
+			true, "about-or-classified", http.StatusOK,
+		},
+		{
+			`[{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"http://www.ft.com/ontology/annotation/about"},
+			  {"id":"http://api.ft.com/things/d969d76e-f8f4-34ae-bc38-95cfd0884740","predicate":"http://www.ft.com/ontology/annotation/hasAuthor","type":"http://www.ft.com/ontology/organisation/Organisation"}]`,
+			false, "", http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		body := `{"id":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":` + test.annotations + `}`
+
+		producer := mockMessageProducer{}
+		deadLetter := mockMessageProducer{}
+		qh := newQueueHandler(sc, &producer, getLogger())
+		qh.deadLetterProducer = &deadLetter
+		qh.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, "tid_rules"), Body: body})
+
+		assert.Equal(t, test.expectedMapped, producer.sendCalled, "Message sending check is wrong. Annotations: %s", test.annotations)
+		assert.Equal(t, !test.expectedMapped, deadLetter.sendCalled, "Dead-letter check is wrong. Annotations: %s", test.annotations)
+		assert.Equal(t, test.expectedViolations, producer.headers[ruleViolationsHeader], "Violations header is wrong. Annotations: %s", test.annotations)
+		if !test.expectedMapped {
+			assert.Equal(t, codeRuleViolation, deadLetter.headers[errorCodeHeader])
+		}
+
+		sh := newServiceHandler(sc, getLogger())
+		req := httptest.NewRequest(http.MethodPost, "/map", strings.NewReader(body))
+		req.Header.Set("X-Request-Id", "tid_rules")
+		w := httptest.NewRecorder()
+		sh.mapRequest(w, req)
+
+		assert.Equal(t, test.expectedStatus, w.Code, "Status is wrong. Annotations: %s", test.annotations)
+		assert.Equal(t, test.expectedViolations, w.Header().Get(ruleViolationsHeader), "Violations header is wrong. Annotations: %s", test.annotations)
+	}
+}
+
+func TestCheckAnnotationRulesOnPublishedAnnotations(t *testing.T) {
+	inferenceRules, err := loadInferenceRules("test-resources/inference-rules.json")
+	require.NoError(t, err)
+	requireMentions := annotationRule{Name: "requires-mentions", Kind: minCountRule, Predicates: []string{"mentions"}, Count: 1, Severity: severityError}
+	sc := serviceConfig{annotationRules: []annotationRule{requireMentions}, inferenceRules: inferenceRules}
+
+	tests := []struct {
+		name          string
+		body          string
+		expectedIsErr bool
+	}{
+		{"derived annotation", `{"id":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+			{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"http://www.ft.com/ontology/annotation/about"}]}`, false},
+		{"no annotation", `{"id":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":[
+			{"id":"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325","predicate":"http://www.ft.com/ontology/classification/isClassifiedBy"}]}`, true},
+		{"delete event", `{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","deleted":true}`, false},
+	}
+
+	for _, test := range tests {
+		vm := videoMapper{sc: sc, strContent: test.body, log: getLogger()}
+		require.NoError(t, vm.unmarshal(context.Background()))
+		_, _, err := vm.mapNextVideoAnnotations(context.Background())
+		assert.Equal(t, test.expectedIsErr, err != nil, "Error status is wrong for the %s", test.name)
+	}
+}
+
+func TestConceptTypeShortForm(t *testing.T) {
+	assert.Equal(t, "Person", conceptTypeShortForm("http://www.ft.com/ontology/person/Person"))
+	assert.Equal(t, "Person", conceptTypeShortForm("Person"))
+}
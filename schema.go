@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+
+	"github.com/gorilla/mux"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	strictValidation  = "strict"
+	lenientValidation = "lenient"
+
+	schemasPath             = "/__schemas"
+	nextVideoPublishSchema  = "next-video-publish.json"
+	nextVideoDeleteSchema   = "next-video-delete.json"
+	conceptAnnotationSchema = "concept-annotation.json"
+)
+
+//go:embed schemas/*.json
+var embeddedSchemas embed.FS
+
+var schemas = mustCompileSchemas()
+
+func mustCompileSchemas() map[string]*jsonschema.Schema {
+	files, err := fs.ReadDir(embeddedSchemas, "schemas")
+	if err != nil {
+		panic(err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	for _, f := range files {
+		data, err := embeddedSchemas.ReadFile(path.Join("schemas", f.Name()))
+		if err != nil {
+			panic(err)
+		}
+		if err := compiler.AddResource(schemaURL(f.Name()), bytes.NewReader(data)); err != nil {
+			panic(fmt.Errorf("adding schema %s: %w", f.Name(), err))
+		}
+	}
+
+	result := make(map[string]*jsonschema.Schema)
+	for _, f := range files {
+		result[f.Name()] = compiler.MustCompile(schemaURL(f.Name()))
+	}
+	return result
+}
+
+func schemaURL(name string) string {
+	return "mem://" + schemasPath + "/" + name
+}
+
+// validateAgainstSchema returns a mappingError with the given code when doc does not match the schema.
+func validateAgainstSchema(name string, doc interface{}, code string) *mappingError {
+	err := schemas[name].Validate(doc)
+	if err == nil {
+		return nil
+	}
+
+	field := ""
+	var ve *jsonschema.ValidationError
+	if errors.As(err, &ve) {
+		for len(ve.Causes) > 0 {
+			ve = ve.Causes[0]
+		}
+		field = ve.InstanceLocation
+	}
+	return newMappingError(code, field, "JSON does not match the %s schema: %v", name, err).withCause(err)
+}
+
+func validateConceptAnnotation(marshalled []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(marshalled, &doc); err != nil {
+		return newMappingError(codeInvalidOutput, "", "mapped ConceptAnnotation is not valid JSON: %v", err).withCause(err)
+	}
+	if err := validateAgainstSchema(conceptAnnotationSchema, doc, codeInvalidOutput); err != nil {
+		return err
+	}
+	return nil
+}
+
+func isValidationMode(mode string) bool {
+	return mode == strictValidation || mode == lenientValidation
+}
+
+func listSchemas(w http.ResponseWriter, _ *http.Request) {
+	names := make([]string, 0, len(schemas))
+	files, _ := fs.ReadDir(embeddedSchemas, "schemas")
+	for _, f := range files {
+		names = append(names, schemasPath+"/"+f.Name())
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(names)
+}
+
+func getSchema(w http.ResponseWriter, r *http.Request) {
+	data, err := embeddedSchemas.ReadFile(path.Join("schemas", mux.Vars(r)["name"]))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/schema+json")
+	_, _ = w.Write(data)
+}
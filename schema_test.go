@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateInput(t *testing.T) {
+	tests := []struct {
+		fileName      string
+		mode          string
+		expectedIsErr bool
+	}{
+		{"next-video-input.json", strictValidation, false},
+		{"next-video-delete-input.json", strictValidation, false},
+		{"next-video-empty-anns-input.json", strictValidation, false},
+		{"next-video-no-anns-input.json", strictValidation, false},
+		{"next-video-invalid-anns-input.json", strictValidation, true},
+		{"next-video-invalid-anns-input.json", lenientValidation, false},
+		{"next-video-no-videouuid-input.json", strictValidation, true},
+		{"next-video-no-videouuid-input.json", lenientValidation, false},
+		{"golden/invalid-annotation-entries.input.json", strictValidation, true},
+		{"golden/invalid-annotation-entries.input.json", lenientValidation, false},
+	}
+
+	for _, test := range tests {
+		nextVideo, err := readContent(test.fileName)
+		require.NoError(t, err)
+		vm := videoMapper{
+			sc:           serviceConfig{inputValidation: test.mode},
+			unmarshalled: nextVideo,
+			log:          getLogger(),
+		}
+
+		err = vm.validateInput()
+		assert.Equal(t, test.expectedIsErr, err != nil, "Error status is wrong. Input JSON: %s, mode: %s", test.fileName, test.mode)
+	}
+}
+
+func TestStrictValidationRejectsMapping(t *testing.T) {
+	nextVideo, err := readContent("golden/invalid-annotation-entries.input.json")
+	require.NoError(t, err)
+	vm := videoMapper{
+		sc:           serviceConfig{inputValidation: strictValidation},
+		unmarshalled: nextVideo,
+		log:          getLogger(),
+	}
+
+	output, _, err := vm.mapNextVideoAnnotations(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, output)
+}
+
+func TestMapNextVideoAnnotationsVideoIDs(t *testing.T) {
+	tests := []struct {
+		body         string
+		expectedCode string
+	}{
+		{`{"id": "not-a-uuid", "annotations": []}`, ""},
+		{`{"id": "", "annotations": []}`, codeMissingField},
+		{`{"uuid": "", "deleted": true}`, codeMissingField},
+	}
+
+	for _, test := range tests {
+		vm := videoMapper{sc: serviceConfig{inputValidation: lenientValidation}, strContent: test.body, log: getLogger()}
+		require.NoError(t, vm.unmarshal(context.Background()))
+		_, _, err := vm.mapNextVideoAnnotations(context.Background())
+		if test.expectedCode == "" {
+			assert.NoError(t, err, "Video should be mapped in lenient mode: %s", test.body)
+			continue
+		}
+		require.Error(t, err, "Video should be rejected: %s", test.body)
+		assert.Equal(t, test.expectedCode, toMappingError(err).Code, "Wrong error code for %s", test.body)
+		assert.Equal(t, http.StatusBadRequest, toMappingError(err).httpStatus(), "Wrong status for %s", test.body)
+	}
+}
+
+func TestValidateConceptAnnotation(t *testing.T) {
+	tests := []struct {
+		concept       string
+		expectedIsErr bool
+	}{
+		{
+			newStringConceptAnnotation(t, "e2290d14-7e80-4db8-a715-949da4de9a07",
+				[]annotation{{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "isClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}},
+			),
+			false,
+		},
+		{
+			newStringConceptAnnotation(t, "e2290d14-7e80-4db8-a715-949da4de9a07", nil),
+			false,
+		},
+		{
+			newStringConceptAnnotation(t, "not-a-uuid", nil),
+			false,
+		},
+		{
+			newStringConceptAnnotation(t, "", nil),
+			true,
+		},
+		{
+			newStringConceptAnnotation(t, "e2290d14-7e80-4db8-a715-949da4de9a07",
+				[]annotation{{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "unknownPredicate", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}},
+			),
+			true,
+		},
+		{
+			`{"uuid":"e2290d14-7e80-4db8-a715-949da4de9a07","annotations":null}`,
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		err := validateConceptAnnotation([]byte(test.concept))
+		assert.Equal(t, test.expectedIsErr, err != nil, "Error status is wrong. ConceptAnnotation: %s", test.concept)
+	}
+}
+
+func TestSchemasEndpoints(t *testing.T) {
+	r := mux.NewRouter()
+	r.Path(schemasPath).HandlerFunc(listSchemas)
+	r.Path(schemasPath + "/{name}").HandlerFunc(getSchema)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, schemasPath, nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var names []string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &names))
+	assert.ElementsMatch(t, []string{
+		schemasPath + "/" + conceptAnnotationSchema,
+		schemasPath + "/" + nextVideoDeleteSchema,
+		schemasPath + "/" + nextVideoPublishSchema,
+	}, names)
+
+	for _, name := range names {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, name, nil))
+		assert.Equal(t, http.StatusOK, w.Code, "Schema %s should be served", name)
+		assert.Equal(t, "application/schema+json", w.Header().Get("Content-Type"))
+		assert.True(t, json.Valid(w.Body.Bytes()), "Schema %s should be valid JSON", name)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, schemasPath+"/unknown.json", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"net/http"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type serviceHandler struct {
@@ -21,41 +24,77 @@ func newServiceHandler(sc serviceConfig, log *logger.UPPLogger) *serviceHandler
 func (h serviceHandler) mapRequest(w http.ResponseWriter, r *http.Request) {
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		writerBadRequest(w, err, "", h.log)
+		writeMappingError(w, newMappingError(codeInvalidJSON, "", "request body couldn't be read: %v", err).withCause(err), "", h.log)
+		return
 	}
 	tid := r.Header.Get("X-Request-Id")
 
-	vm := videoMapper{sc: h.sc, strContent: string(body), tid: tid, log: h.log}
+	ctx, span := startSpan(extractTraceContext(r.Context(), propagation.HeaderCarrier(r.Header)), "mapRequest",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("transaction_id", tid)),
+	)
+	defer span.End()
 
-	mappedVideoBytes, _, err := h.mapNextVideoAnnotationsRequest(&vm)
+	vm := videoMapper{sc: h.sc, strContent: string(body), envelope: r.Header.Get(envelopeHeader), tid: tid, log: h.log}
+
+	mappedVideoBytes, videoUUID, err := h.mapNextVideoAnnotationsRequest(ctx, &vm)
+	span.SetAttributes(attribute.String("video_uuid", videoUUID))
+	if vm.tid != "" {
+		w.Header().Set("X-Request-Id", vm.tid)
+	}
+	if vm.syntheticTID {
+		w.Header().Set(syntheticTIDHeader, "true")
+	}
 	if err != nil {
-		writerBadRequest(w, err, tid, h.log)
+		recordSpanError(span, err)
+		writeMappingError(w, err, vm.tid, h.log)
+		return
+	}
+	if len(vm.ruleViolations) > 0 {
+		w.Header().Set(ruleViolationsHeader, ruleViolationsHeaderValue(vm.ruleViolations))
+	}
+
+	if r.URL.Query().Get(explainParam) == "true" {
+		mappedVideoBytes, err = vm.explain(mappedVideoBytes)
+		if err != nil {
+			writeMappingError(w, err, vm.tid, h.log)
+			return
+		}
 	}
 
 	w.Header().Add("Content-Type", "application/json")
 	_, err = w.Write(mappedVideoBytes)
 	if err != nil {
-		h.log.WithTransactionID(tid).
+		h.log.WithTransactionID(vm.tid).
 			WithValidFlag(true).
 			WithError(err).
 			Error("Writing response error.")
 	}
 }
 
-func (h serviceHandler) mapNextVideoAnnotationsRequest(vm *videoMapper) ([]byte, string, error) {
-	if err := json.Unmarshal([]byte(vm.strContent), &vm.unmarshalled); err != nil {
-		return nil, "", fmt.Errorf("video JSON from Next couldn't be unmarshalled: %v. Skipping invalid JSON with tid: %s", err, vm.tid)
+func (h serviceHandler) mapNextVideoAnnotationsRequest(ctx context.Context, vm *videoMapper) ([]byte, string, error) {
+	if err := vm.unmarshal(ctx); err != nil {
+		return nil, "", err
 	}
-	return vm.mapNextVideoAnnotations()
+	if err := vm.resolveTransactionID(generateMissingTID); err != nil {
+		return nil, "", err
+	}
+	return vm.mapNextVideoAnnotations(ctx)
 }
 
-func writerBadRequest(w http.ResponseWriter, err error, tid string, log *logger.UPPLogger) {
-	w.WriteHeader(http.StatusBadRequest)
-	_, err2 := w.Write([]byte(err.Error()))
+// writeMappingError responds with the JSON representation of the mappingError, using the HTTP status matching its code.
+func writeMappingError(w http.ResponseWriter, err error, tid string, log *logger.UPPLogger) {
+	me := toMappingError(err)
+	recordMappingError(me)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(me.httpStatus())
+	err2 := json.NewEncoder(w).Encode(me)
 	if err2 != nil {
 		log.WithTransactionID(tid).
 			WithValidFlag(false).
 			WithError(err).
-			Error("Couldn't write Bad Request response.")
+			WithFields(me.logFields()).
+			Error("Couldn't write error response.")
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/Financial-Times/go-logger/v2"
@@ -22,7 +23,7 @@ func TestMapRequest(t *testing.T) {
 		{
 			"next-video-input.json",
 			newStringConceptAnnotation(t, "e2290d14-7e80-4db8-a715-949da4de9a07",
-				[]annotation{{"http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", "isClassifiedBy", defaultRelevanceScore, defaultConfidenceScore}},
+				[]annotation{{ID: "http://api.ft.com/things/71a5efa5-e6e0-3ce1-9190-a7eac8bef325", Predicate: "isClassifiedBy", RelevanceScore: defaultRelevanceScore, ConfidenceScore: defaultConfidenceScore}},
 			),
 			http.StatusOK,
 		},
@@ -59,6 +60,32 @@ func TestMapRequest(t *testing.T) {
 	}
 }
 
+func TestMapRequestMissingTID(t *testing.T) {
+	tests := []struct {
+		policy             string
+		expectedHTTPStatus int
+		expectedSynthetic  string
+	}{
+		{"", http.StatusOK, "true"},
+		{rejectMissingTID, http.StatusBadRequest, ""},
+		{generateMissingTID, http.StatusOK, "true"},
+	}
+
+	for _, test := range tests {
+		h := newServiceHandler(serviceConfig{missingTIDPolicy: test.policy}, getLogger())
+		req := httptest.NewRequest("POST", "http://next-video-annotaitons-mapper.ft.com/map", getReader("next-video-input.json", t))
+		w := httptest.NewRecorder()
+
+		h.mapRequest(w, req)
+
+		assert.Equal(t, test.expectedHTTPStatus, w.Code, "HTTP status wrong. Policy: %s", test.policy)
+		assert.Equal(t, test.expectedSynthetic, w.Header().Get(syntheticTIDHeader), "Synthetic tid header wrong. Policy: %s", test.policy)
+		if test.expectedSynthetic != "" {
+			assert.True(t, strings.HasPrefix(w.Header().Get("X-Request-Id"), transactionIDPrefix), "Generated tid should be returned. Policy: %s", test.policy)
+		}
+	}
+}
+
 func getReader(fileName string, t *testing.T) *os.File {
 	file, err := os.Open("test-resources/" + fileName)
 	if err != nil {
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/google/uuid"
+)
+
+const (
+	rejectMissingTID   = "reject"
+	generateMissingTID = "generate"
+
+	transactionIDPrefix = "tid_"
+	syntheticTIDHeader  = "X-Request-Id-Synthetic"
+)
+
+// isMissingTIDPolicy tells whether the policy is known. An empty policy keeps the default of each path.
+func isMissingTIDPolicy(policy string) bool {
+	return policy == "" || policy == rejectMissingTID || policy == generateMissingTID
+}
+
+func newTransactionID() string {
+	return transactionIDPrefix + uuid.New().String()
+}
+
+// resolveTransactionID applies the configured policy when the message came without a transaction ID,
+// or the default policy of the path when none is configured:
+// either the message is rejected, or a synthetic transaction ID is generated for it.
+func (vm *videoMapper) resolveTransactionID(defaultPolicy string) error {
+	if vm.tid != "" {
+		return nil
+	}
+	policy := vm.sc.missingTIDPolicy
+	if policy == "" {
+		policy = defaultPolicy
+	}
+	if policy != generateMissingTID {
+		return newMappingError(codeMissingTID, "", "X-Request-Id not found in message headers")
+	}
+
+	vm.tid = newTransactionID()
+	vm.syntheticTID = true
+	vm.log.WithTransactionID(vm.tid).
+		Info("X-Request-Id is missing, generated a synthetic transaction ID")
+	return nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testTraceParent = "00-" + testTraceID + "-00f067aa0ba902b7-01"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	previousProvider := otel.GetTracerProvider()
+	previousPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+	return recorder
+}
+
+func spansByName(recorder *tracetest.SpanRecorder) map[string]sdktrace.ReadOnlySpan {
+	result := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		result[span.Name()] = span
+	}
+	return result
+}
+
+func TestQueueConsumeTracing(t *testing.T) {
+	recorder := recordSpans(t)
+	producer := &mockMessageProducer{}
+	h := newQueueHandler(serviceConfig{}, producer, getLogger())
+
+	headers := createHeaders(nextVideoOrigin, "tid_trace")
+	headers["traceparent"] = testTraceParent
+	h.queueConsume(Message{Headers: headers, Body: string(getBytes("next-video-input.json", t))})
+
+	spans := spansByName(recorder)
+	for _, name := range []string{"queueConsume", "unmarshal", "mapNextVideoAnnotations", "sendMessage"} {
+		require.Contains(t, spans, name, "Span %s should be recorded", name)
+		assert.Equal(t, testTraceID, spans[name].SpanContext().TraceID().String(), "Span %s should continue the incoming trace", name)
+	}
+	assert.Equal(t, spans["queueConsume"].SpanContext().SpanID(), spans["sendMessage"].Parent().SpanID())
+
+	require.True(t, producer.sendCalled)
+	assert.True(t, strings.HasPrefix(producer.headers["traceparent"], "00-"+testTraceID+"-"), "Trace context should be injected into the produced message")
+	assert.Contains(t, producer.headers["traceparent"], spans["sendMessage"].SpanContext().SpanID().String())
+}
+
+func TestMapNextVideoAnnotationsTracingNestsStages(t *testing.T) {
+	recorder := recordSpans(t)
+	resolver := newHTTPConceptResolver(startStubServer(&conceptsAPIStub{}, t)+"/concepts/", 100*time.Millisecond, 10, time.Minute)
+	vm := videoMapper{sc: serviceConfig{conceptResolver: resolver}, strContent: string(getBytes("next-video-input.json", t)), log: getLogger()}
+	require.NoError(t, vm.unmarshal(context.Background()))
+
+	_, _, err := vm.mapNextVideoAnnotations(context.Background())
+	require.NoError(t, err)
+
+	spans := spansByName(recorder)
+	require.Contains(t, spans, "resolveConcepts")
+	assert.Equal(t, spans["mapNextVideoAnnotations"].SpanContext().SpanID(), spans["resolveConcepts"].Parent().SpanID(),
+		"The mapping stages should be traced within the mapping span")
+}
+
+func TestQueueConsumeTracingRecordsErrors(t *testing.T) {
+	recorder := recordSpans(t)
+	h := newQueueHandler(serviceConfig{}, &mockMessageProducer{}, getLogger())
+
+	h.queueConsume(Message{Headers: createHeaders(nextVideoOrigin, "tid_trace"), Body: string(getBytes("invalid-format.json", t))})
+
+	spans := spansByName(recorder)
+	require.Contains(t, spans, "queueConsume")
+	require.Contains(t, spans, "unmarshal")
+	assert.Equal(t, codes.Error, spans["unmarshal"].Status().Code)
+	assert.Equal(t, codes.Error, spans["queueConsume"].Status().Code)
+	assert.NotContains(t, spans, "sendMessage")
+}
+
+func TestMapRequestTracing(t *testing.T) {
+	recorder := recordSpans(t)
+	h := newServiceHandler(serviceConfig{}, getLogger())
+
+	req := httptest.NewRequest(http.MethodPost, "/map", getReader("next-video-input.json", t))
+	req.Header.Set("traceparent", testTraceParent)
+	req.Header.Set("X-Request-Id", "tid_trace")
+	w := httptest.NewRecorder()
+	h.mapRequest(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	spans := spansByName(recorder)
+	for _, name := range []string{"mapRequest", "unmarshal", "mapNextVideoAnnotations"} {
+		require.Contains(t, spans, name, "Span %s should be recorded", name)
+		assert.Equal(t, testTraceID, spans[name].SpanContext().TraceID().String(), "Span %s should continue the incoming trace", name)
+	}
+}
+
+func TestInitTracing(t *testing.T) {
+	recordSpans(t)
+
+	shutdown, err := initTracing(noExporter, "test")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = initTracing("unknown", "test")
+	assert.Error(t, err)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/kafka-client-go/v3"
+)
+
+const (
+	kafkaTransport  = "kafka"
+	ndjsonTransport = "ndjson"
+)
+
+// Message is the transport-agnostic representation of a message read from a Source or written to a Sink.
+type Message struct {
+	Headers map[string]string
+	Body    string
+	// settle is set by the sources which can commit the consumed messages out of order
+	settle func(result <-chan error)
+}
+
+// settleLater hands the result of a consumed message, still to come on result, over to its source,
+// which then commits the message once the result is received without waiting for it.
+// It returns false when the source can't do that, in which case the caller has to wait for the result.
+func (m Message) settleLater(result <-chan error) bool {
+	if m.settle == nil {
+		return false
+	}
+	m.settle(result)
+	return true
+}
+
+// Source delivers incoming messages to a handler.
+// The handler returns an error when the message was not handled and must be delivered again,
+// so a Source only commits the messages for which the handler succeeded, or whose later result it was handed.
+// Start may block, so callers are expected to run it in its own goroutine.
+type Source interface {
+	Start(handler func(Message) error)
+	Close() error
+	ConnectivityCheck() error
+	MonitorCheck() error
+}
+
+// Sink publishes outgoing messages.
+type Sink interface {
+	SendMessage(Message) error
+	Close() error
+	ConnectivityCheck() error
+}
+
+// kafkaSink adapts kafka.Producer to the Sink interface.
+type kafkaSink struct {
+	*kafka.Producer
+}
+
+func newKafkaSink(producer *kafka.Producer) *kafkaSink {
+	return &kafkaSink{Producer: producer}
+}
+
+func (s *kafkaSink) SendMessage(m Message) error {
+	return s.Producer.SendMessage(kafka.FTMessage{Headers: m.Headers, Body: m.Body})
+}
+
+type transportConfig struct {
+	source               string
+	sourceFile           string
+	sink                 string
+	sinkFile             string
+	kafkaAddress         string
+	group                string
+	readTopic            string
+	writeTopic           string
+	deadLetterTopic      string
+	deadLetterFile       string
+	qualityTopic         string
+	qualityFile          string
+	relatedTopic         string
+	relatedFile          string
+	consumerLagTolerance int
+	maxRedeliveries      int
+	coalescingWindow     time.Duration
+}
+
+// outputs holds the sinks the service writes to. Only annotations is mandatory.
+type outputs struct {
+	annotations Sink
+	deadLetter  Sink
+	quality     Sink
+	related     Sink
+}
+
+func (o outputs) close(log *logger.UPPLogger) {
+	for _, sink := range []Sink{o.annotations, o.deadLetter, o.quality, o.related} {
+		if sink == nil {
+			continue
+		}
+		if err := sink.Close(); err != nil {
+			log.WithError(err).Error("Producer could not stop")
+		}
+	}
+}
+
+func (tc transportConfig) usesKafka() bool {
+	return tc.source == kafkaTransport || tc.sink == kafkaTransport
+}
+
+func newSource(tc transportConfig, log *logger.UPPLogger) (Source, error) {
+	switch tc.source {
+	case kafkaTransport:
+		return newKafkaSource(tc, log), nil
+	case ndjsonTransport:
+		source, err := newNDJSONSource(tc.sourceFile, tc.maxRedeliveries, log)
+		if err != nil {
+			return nil, err
+		}
+		return source, nil
+	default:
+		return nil, fmt.Errorf("unknown message source %q", tc.source)
+	}
+}
+
+func newOutputs(tc transportConfig, log *logger.UPPLogger) (outputs, error) {
+	var out outputs
+	var err error
+
+	out.annotations, err = newSink(tc, tc.writeTopic, tc.sinkFile, log)
+	if err != nil {
+		return outputs{}, err
+	}
+	if tc.coalescingWindow > 0 {
+		out.annotations = newCoalescingSink(out.annotations, tc.coalescingWindow, tc.maxRedeliveries, log)
+	}
+
+	out.deadLetter, err = newOptionalSink(tc, tc.deadLetterTopic, tc.deadLetterFile, log)
+	if err != nil {
+		out.close(log)
+		return outputs{}, err
+	}
+	out.quality, err = newOptionalSink(tc, tc.qualityTopic, tc.qualityFile, log)
+	if err != nil {
+		out.close(log)
+		return outputs{}, err
+	}
+	out.related, err = newOptionalSink(tc, tc.relatedTopic, tc.relatedFile, log)
+	if err != nil {
+		out.close(log)
+		return outputs{}, err
+	}
+	return out, nil
+}
+
+// hasSink tells whether the topic or the file of an optional sink, depending on the configured transport, is set.
+func (tc transportConfig) hasSink(topic, file string) bool {
+	return (tc.sink == kafkaTransport && topic != "") || (tc.sink == ndjsonTransport && file != "")
+}
+
+// newOptionalSink creates a sink only if its topic or file, depending on the configured transport, is set.
+func newOptionalSink(tc transportConfig, topic, file string, log *logger.UPPLogger) (Sink, error) {
+	if !tc.hasSink(topic, file) {
+		return nil, nil
+	}
+	return newSink(tc, topic, file, log)
+}
+
+// newSink creates a sink of the configured transport, writing either to the given topic or to the given NDJSON file.
+func newSink(tc transportConfig, topic, file string, log *logger.UPPLogger) (Sink, error) {
+	switch tc.sink {
+	case kafkaTransport:
+		producerConfig := kafka.ProducerConfig{
+			BrokersConnectionString: tc.kafkaAddress,
+			Topic:                   topic,
+			ConnectionRetryInterval: time.Minute,
+		}
+		return newKafkaSink(kafka.NewProducer(producerConfig, log)), nil
+	case ndjsonTransport:
+		sink, err := newNDJSONSink(file)
+		if err != nil {
+			return nil, err
+		}
+		return sink, nil
+	default:
+		return nil, fmt.Errorf("unknown message sink %q", tc.sink)
+	}
+}